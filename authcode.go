@@ -0,0 +1,299 @@
+package gclientauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// authRequest is an authorization request whose code still has to be exchanged
+// for a token.
+type authRequest struct {
+	state    string
+	verifier string // PKCE code verifier, empty if PKCE isn't used
+	opts     []oauth2.AuthCodeOption
+	// hostedDomain is the Workspace domain the user must belong to, empty
+	// if any account is allowed.
+	hostedDomain string
+	// httpClient is the client set with WithHTTPClient or WithTransport,
+	// nil for the client in the context of the exchange.
+	httpClient *http.Client
+	// attempts and backoff are the retries of the exchange set with
+	// WithExchangeRetry.
+	attempts int
+	backoff  time.Duration
+}
+
+// newAuthRequest returns an authorization request with a random state and, if
+// enabled by o, a PKCE code verifier.  installed is whether the credential is
+// a desktop/other credential.
+func newAuthRequest(o *options, installed bool) (*authRequest, error) {
+	state, err := newState()
+	if err != nil {
+		return nil, err
+	}
+	req := exchangeRequest(o, "")
+	req.state = state
+	req.opts = []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("access_type", string(o.accessType))}
+	if o.usePKCE(installed) {
+		if req.verifier, err = newCodeVerifier(); err != nil {
+			return nil, err
+		}
+		req.opts = append(req.opts, challengeOptions(req.verifier)...)
+	}
+	if o.incrementalAuth {
+		req.opts = append(req.opts, oauth2.SetAuthURLParam("include_granted_scopes", "true"))
+	}
+	if o.forceConsent {
+		req.opts = append(req.opts, oauth2.ApprovalForce)
+	}
+	if o.loginHint != "" {
+		req.opts = append(req.opts, oauth2.SetAuthURLParam("login_hint", o.loginHint))
+	}
+	if o.hostedDomain != "" {
+		req.opts = append(req.opts, oauth2.SetAuthURLParam("hd", o.hostedDomain))
+	}
+	// Added last so they override the parameters set above.
+	req.opts = append(req.opts, o.authCodeOpts...)
+	return req, nil
+}
+
+// exchangeRequest returns a request with the settings of o for exchanging a
+// code with the PKCE code verifier, empty if PKCE isn't used.
+func exchangeRequest(o *options, verifier string) *authRequest {
+	return &authRequest{
+		verifier:     verifier,
+		hostedDomain: o.hostedDomain,
+		httpClient:   o.client(),
+		attempts:     o.exchangeAttempts,
+		backoff:      o.exchangeBackoff,
+	}
+}
+
+// url returns the URL of Google's consent page for the request.
+func (r *authRequest) url(config *oauth2.Config) string {
+	return config.AuthCodeURL(r.state, r.opts...)
+}
+
+// exchange exchanges the code received for the request for a token.  If the
+// request is restricted to a hosted domain and the token has an ID token, the
+// user's domain must match it.  The JSON response of the token endpoint is
+// returned decoded too, or nil if it isn't JSON.
+func (r *authRequest) exchange(ctx context.Context, config *oauth2.Config, code string) (*oauth2.Token, map[string]interface{}, error) {
+	if r.httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, r.httpClient)
+	}
+	// The oauth2 package doesn't let the fields it doesn't know be listed so
+	// the response is kept as it is read.
+	c := *contextClient(ctx)
+	capture := &captureTransport{base: c.Transport}
+	c.Transport = capture
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &c)
+
+	var opts []oauth2.AuthCodeOption
+	if r.verifier != "" {
+		opts = append(opts, verifierOption(r.verifier))
+	}
+	var token *oauth2.Token
+	err := withRetry(ctx, r.attempts, r.backoff, func() (err error) {
+		token, err = config.Exchange(ctx, code, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkHostedDomain(token, r.hostedDomain); err != nil {
+		return nil, nil, err
+	}
+	var raw map[string]interface{}
+	if json.Unmarshal(capture.body, &raw) != nil {
+		raw = nil
+	}
+	return token, raw, nil
+}
+
+// checkHostedDomain returns ErrHostedDomainMismatch if domain isn't empty and
+// the hd claim of the token's ID token isn't domain.  Tokens without an ID
+// token (the openid scope wasn't requested) can't be checked.
+func checkHostedDomain(token *oauth2.Token, domain string) error {
+	if domain == "" || token.Extra("id_token") == nil {
+		return nil
+	}
+	claims, err := ParseIDToken(token)
+	if err != nil {
+		return err
+	}
+	if claims.HostedDomain != domain {
+		return withSentinel(ErrHostedDomainMismatch, "user's domain %q isn't %q", claims.HostedDomain, domain)
+	}
+	return nil
+}
+
+// newState returns a random state for an authorization request so the
+// response can be checked against it to protect against CSRF.
+func newState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate state. %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pendingTTL is how long a request from GetAuthURL is kept for ExchangeCode.
+// Google's authorization codes expire well before, so an older request is
+// one the user abandoned.
+const pendingTTL = 15 * time.Minute
+
+// pendingRequest is a request from GetAuthURL waiting for its code.
+type pendingRequest struct {
+	req     *authRequest
+	now     func() time.Time // clock set with WithClock
+	expires time.Time
+}
+
+// expired returns whether the request is older than pendingTTL.
+func (p pendingRequest) expired() bool {
+	return !p.now().Before(p.expires)
+}
+
+// pending holds the requests created by GetAuthURL until their code is
+// exchanged by ExchangeCode or they expire.
+var pending = struct {
+	sync.Mutex
+	requests map[string]pendingRequest
+}{requests: make(map[string]pendingRequest)}
+
+// GetAuthURL returns the URL of Google's consent page and the state of the
+// request for applications that handle the interaction with the user
+// themselves.  Once the user has authorized the application, pass the code
+// and state to ExchangeCode to get the token.
+//
+// The request, including its PKCE code verifier, is kept in memory until the
+// code is exchanged, for up to 15 minutes, so both calls must be made by the
+// same process.  Use NewAuthCodeRequest and ExchangeCodeWithVerifier if they
+// may not be, e.g. for servers behind a load balancer.
+//
+// PKCE is used unless disabled with WithPKCE(false).  Options that don't
+// affect the authorization URL are ignored, except WithHostedDomain,
+// WithHTTPClient and WithTransport which apply to the exchange and WithClock
+// which applies to the expiry of the request.
+//
+// GetAuthURL panics if the state or code verifier can't be generated, which
+// only happens if the system's random number generator fails.  Use
+// NewAuthCodeRequest to get an error instead.
+func GetAuthURL(config *oauth2.Config, opts ...AuthURLOption) (url, state string) {
+	o := newOptions(opts...)
+	req, err := newAuthRequest(o, true)
+	if err != nil {
+		// crypto/rand only fails if the system's random number
+		// generator is broken, which can't be recovered from.
+		panic(err)
+	}
+
+	pending.Lock()
+	// Abandoned requests are removed here since nothing else would.
+	for s, p := range pending.requests {
+		if p.expired() {
+			delete(pending.requests, s)
+		}
+	}
+	pending.requests[req.state] = pendingRequest{req: req, now: o.now, expires: o.now().Add(pendingTTL)}
+	pending.Unlock()
+	return req.url(config), req.state
+}
+
+// ExchangeCode exchanges the code the user received after visiting the URL
+// returned by GetAuthURL for a token.  state must be the state returned with
+// that URL, otherwise ErrStateMismatch is returned, as it is if the request
+// has expired.  A request can only be exchanged once, but it is kept if the
+// exchange fails for a reason that may not happen again, such as a network
+// error, server error or cancelled context, so the exchange can be retried.
+func ExchangeCode(ctx context.Context, config *oauth2.Config, code, state string) (*oauth2.Token, error) {
+	// The request is taken out during the exchange so concurrent calls
+	// can't exchange it twice.
+	pending.Lock()
+	p, ok := pending.requests[state]
+	delete(pending.requests, state)
+	pending.Unlock()
+	if !ok {
+		return nil, ErrStateMismatch
+	}
+	if p.expired() {
+		return nil, withSentinel(ErrStateMismatch, "authorization request has expired")
+	}
+
+	token, _, err := p.req.exchange(ctx, config, code)
+	if err != nil {
+		if transient(err) {
+			pending.Lock()
+			pending.requests[state] = p
+			pending.Unlock()
+		}
+		return nil, withSentinel(ErrTokenExchange, "unable to get valid token. %w", err)
+	}
+	return token, nil
+}
+
+// transient returns whether the exchange that failed with err may succeed if
+// ExchangeCode is called again later: the error is retryable, or the context
+// was done, since the later call has its own context.
+func transient(err error) bool {
+	return retryable(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// AuthCodeRequest is an authorization request created by NewAuthCodeRequest
+// that the caller keeps until the code is exchanged.
+type AuthCodeRequest struct {
+	// URL is the URL of Google's consent page.
+	URL string
+	// State must be checked against the state of the authorization
+	// response to protect against CSRF.
+	State string
+	// Verifier is the PKCE code verifier to pass to
+	// ExchangeCodeWithVerifier, empty if PKCE isn't used.  It is a secret
+	// and must be kept where the user can't see it, e.g. not in a cookie
+	// that isn't encrypted.
+	Verifier string
+}
+
+// NewAuthCodeRequest is like GetAuthURL but doesn't keep the request so it
+// can be exchanged by another process, e.g. another instance of a server.
+// The caller keeps the request, checks the state of the response and passes
+// the code and verifier to ExchangeCodeWithVerifier.
+func NewAuthCodeRequest(config *oauth2.Config, opts ...Option) (*AuthCodeRequest, error) {
+	req, err := newAuthRequest(newOptions(opts...), true)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthCodeRequest{URL: req.url(config), State: req.state, Verifier: req.verifier}, nil
+}
+
+// ExchangeCodeWithVerifier exchanges the code the user received after
+// visiting the URL of a request from NewAuthCodeRequest for a token.  verifier
+// is the request's Verifier.  The state isn't checked, the caller must have
+// checked it.  The options of the exchange, such as WithHostedDomain, should
+// be the ones passed to NewAuthCodeRequest.
+func ExchangeCodeWithVerifier(ctx context.Context, config *oauth2.Config, code, verifier string, opts ...Option) (*oauth2.Token, error) {
+	token, _, err := ExchangeCodeWithVerifierRaw(ctx, config, code, verifier, opts...)
+	return token, err
+}
+
+// ExchangeCodeWithVerifierRaw is like ExchangeCodeWithVerifier but also
+// returns the decoded JSON response of the token endpoint for the fields
+// oauth2.Token doesn't have, such as id_token, scope and
+// refresh_token_expires_in.
+func ExchangeCodeWithVerifierRaw(ctx context.Context, config *oauth2.Config, code, verifier string, opts ...Option) (*oauth2.Token, map[string]interface{}, error) {
+	token, raw, err := exchangeRequest(newOptions(opts...), verifier).exchange(ctx, config, code)
+	if err != nil {
+		return nil, nil, withSentinel(ErrTokenExchange, "unable to get valid token. %w", err)
+	}
+	return token, raw, nil
+}
@@ -0,0 +1,270 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// testConfig returns a config for the fake authorization server.
+func testConfig(srv *tokenServer) *oauth2.Config {
+	return &oauth2.Config{ClientID: "client", ClientSecret: "secret", Endpoint: srv.endpoint(), RedirectURL: "http://localhost/cb", Scopes: []string{"email"}}
+}
+
+func TestGetAuthURLExchangeCode(t *testing.T) {
+	srv := newTokenServer(t)
+	config := testConfig(srv)
+	authURL, state := GetAuthURL(config)
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("state"); got != state {
+		t.Errorf("state of the URL = %q, want %q", got, state)
+	}
+
+	token, err := ExchangeCode(context.Background(), config, "c", state)
+	if err != nil {
+		t.Fatalf("ExchangeCode() error = %v", err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want %q", token.AccessToken, "at")
+	}
+	if v := srv.lastForm().Get("code_verifier"); codeChallenge(v) != u.Query().Get("code_challenge") {
+		t.Errorf("code_verifier %q doesn't match the challenge of the URL", v)
+	}
+	if _, err := ExchangeCode(context.Background(), config, "c", state); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("second ExchangeCode() error = %v, want %v", err, ErrStateMismatch)
+	}
+}
+
+func TestExchangeCodeUnknownState(t *testing.T) {
+	srv := newTokenServer(t)
+	if _, err := ExchangeCode(context.Background(), testConfig(srv), "c", "unknown"); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("ExchangeCode() error = %v, want %v", err, ErrStateMismatch)
+	}
+	if n := len(srv.forms); n != 0 {
+		t.Errorf("%d requests to the token endpoint, want none", n)
+	}
+}
+
+func TestExchangeCodeFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantRetry bool
+	}{
+		{name: "server error", status: http.StatusServiceUnavailable, body: `{"error":"unavailable"}`, wantRetry: true},
+		{name: "invalid grant", status: http.StatusBadRequest, body: `{"error":"invalid_grant"}`, wantRetry: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTokenServer(t)
+			srv.respond = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}
+			config := testConfig(srv)
+			_, state := GetAuthURL(config)
+			if _, err := ExchangeCode(context.Background(), config, "c", state); !errors.Is(err, ErrTokenExchange) {
+				t.Fatalf("ExchangeCode() error = %v, want %v", err, ErrTokenExchange)
+			}
+
+			srv.mu.Lock()
+			srv.respond = nil
+			srv.mu.Unlock()
+			token, err := ExchangeCode(context.Background(), config, "c", state)
+			if tt.wantRetry {
+				if err != nil || token.AccessToken != "at" {
+					t.Errorf("retried ExchangeCode() = %v, %v, want the token", token, err)
+				}
+			} else if !errors.Is(err, ErrStateMismatch) {
+				t.Errorf("retried ExchangeCode() error = %v, want %v", err, ErrStateMismatch)
+			}
+		})
+	}
+}
+
+func TestGetAuthURLExpiry(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	srv := newTokenServer(t)
+	config := testConfig(srv)
+	_, state := GetAuthURL(config, WithClock(clock))
+
+	mu.Lock()
+	now = now.Add(pendingTTL)
+	mu.Unlock()
+	// The expired request is removed by the next call.
+	GetAuthURL(config, WithClock(clock))
+	pending.Lock()
+	_, ok := pending.requests[state]
+	pending.Unlock()
+	if ok {
+		t.Error("the expired request is still pending")
+	}
+	if _, err := ExchangeCode(context.Background(), config, "c", state); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("ExchangeCode() error = %v, want %v", err, ErrStateMismatch)
+	}
+}
+
+func TestExchangeCodeExpired(t *testing.T) {
+	now := time.Now()
+	srv := newTokenServer(t)
+	config := testConfig(srv)
+	_, state := GetAuthURL(config, WithClock(func() time.Time { return now }))
+	now = now.Add(pendingTTL)
+	if _, err := ExchangeCode(context.Background(), config, "c", state); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("ExchangeCode() error = %v, want %v", err, ErrStateMismatch)
+	}
+}
+
+// authURLQuery returns the query of the authorization URL of a request with
+// the options.
+func authURLQuery(t *testing.T, opts ...Option) url.Values {
+	req, err := newAuthRequest(newOptions(opts...), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(req.url(&oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
+
+func TestIncrementalAuthURL(t *testing.T) {
+	if got := authURLQuery(t).Get("include_granted_scopes"); got != "" {
+		t.Errorf("include_granted_scopes = %q by default, want none", got)
+	}
+	if got := authURLQuery(t, WithIncrementalAuth(true)).Get("include_granted_scopes"); got != "true" {
+		t.Errorf("include_granted_scopes = %q, want true", got)
+	}
+}
+
+func TestForceConsentURL(t *testing.T) {
+	if got := authURLQuery(t).Get("prompt"); got != "" {
+		t.Errorf("prompt = %q by default, want none", got)
+	}
+	if got := authURLQuery(t, WithForceConsent(true)).Get("prompt"); got != "consent" {
+		t.Errorf("prompt = %q, want consent", got)
+	}
+}
+
+func TestLoginHintURL(t *testing.T) {
+	if got := authURLQuery(t, WithLoginHint("user@example.com")).Get("login_hint"); got != "user@example.com" {
+		t.Errorf("login_hint = %q, want user@example.com", got)
+	}
+}
+
+func TestHostedDomainURL(t *testing.T) {
+	if got := authURLQuery(t, WithHostedDomain("example.com")).Get("hd"); got != "example.com" {
+		t.Errorf("hd = %q, want example.com", got)
+	}
+}
+
+func TestCheckHostedDomain(t *testing.T) {
+	withHD := (&oauth2.Token{AccessToken: "at"}).WithExtra(map[string]interface{}{"id_token": fakeIDToken(`{"sub":"1","hd":"example.com"}`)})
+	withoutHD := (&oauth2.Token{AccessToken: "at"}).WithExtra(map[string]interface{}{"id_token": fakeIDToken(`{"sub":"1"}`)})
+	tests := []struct {
+		name   string
+		token  *oauth2.Token
+		domain string
+		want   error
+	}{
+		{name: "same domain", token: withHD, domain: "example.com"},
+		{name: "other domain", token: withHD, domain: "example.org", want: ErrHostedDomainMismatch},
+		{name: "consumer account", token: withoutHD, domain: "example.com", want: ErrHostedDomainMismatch},
+		{name: "no ID token", token: &oauth2.Token{AccessToken: "at"}, domain: "example.com"},
+		{name: "any domain", token: withHD},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkHostedDomain(tt.token, tt.domain); !errors.Is(err, tt.want) {
+				t.Errorf("checkHostedDomain() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessTypeURL(t *testing.T) {
+	if got := authURLQuery(t).Get("access_type"); got != "offline" {
+		t.Errorf("access_type = %q by default, want offline", got)
+	}
+	if got := authURLQuery(t, WithAccessType(AccessTypeOnline)).Get("access_type"); got != "online" {
+		t.Errorf("access_type = %q, want online", got)
+	}
+}
+
+func TestAuthCodeOptionsURL(t *testing.T) {
+	q := authURLQuery(t, WithAuthCodeOptions(oauth2.SetAuthURLParam("custom", "value"), oauth2.SetAuthURLParam("access_type", "online")))
+	if got := q.Get("custom"); got != "value" {
+		t.Errorf("custom = %q, want value", got)
+	}
+	// They are applied after the parameters of the package.
+	if got := q.Get("access_type"); got != "online" {
+		t.Errorf("access_type = %q, want the one of WithAuthCodeOptions", got)
+	}
+	if q.Get("state") == "" || q.Get("code_challenge") == "" {
+		t.Errorf("state or code_challenge missing from %v", q)
+	}
+}
+
+func TestExchangeCodeWithVerifierRaw(t *testing.T) {
+	srv := newTokenServer(t)
+	idToken := fakeIDToken(`{"email":"user@example.com"}`)
+	srv.response = `{"access_token":"at","refresh_token":"rt","expires_in":3600,"token_type":"Bearer","scope":"openid email","id_token":"` + idToken + `","refresh_token_expires_in":604800}`
+	rec := &recordingTransport{}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: rec})
+	token, raw, err := ExchangeCodeWithVerifierRaw(ctx, testConfig(srv), "c", "verifier")
+	if err != nil {
+		t.Fatalf("ExchangeCodeWithVerifierRaw() error = %v", err)
+	}
+	if token.AccessToken != "at" || token.RefreshToken != "rt" {
+		t.Errorf("token = %+v, want the exchanged token", token)
+	}
+	for key, want := range map[string]interface{}{"id_token": idToken, "scope": "openid email", "refresh_token_expires_in": float64(604800), "access_token": "at"} {
+		if raw[key] != want {
+			t.Errorf("raw[%q] = %v, want %v", key, raw[key], want)
+		}
+	}
+	if got := srv.lastForm().Get("code_verifier"); got != "verifier" {
+		t.Errorf("code_verifier = %q, want the verifier", got)
+	}
+	// The response is captured with the caller's HTTP client.
+	if !rec.saw(srv.endpoint().TokenURL) {
+		t.Errorf("the client sent %q, want the token exchange", rec.urls)
+	}
+
+	// The response can be URL encoded, which has no JSON to return.
+	srv.respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		io.WriteString(w, "access_token=form&token_type=Bearer&expires_in=3600")
+	}
+	if token, raw, err := ExchangeCodeWithVerifierRaw(context.Background(), testConfig(srv), "c", "verifier"); err != nil || token.AccessToken != "form" || raw != nil {
+		t.Errorf("ExchangeCodeWithVerifierRaw() of a URL encoded response = %+v, %v, %v, want the token and no JSON", token, raw, err)
+	}
+
+	srv.respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid_grant"}`)
+	}
+	if token, raw, err := ExchangeCodeWithVerifierRaw(context.Background(), testConfig(srv), "c", "verifier"); !errors.Is(err, ErrTokenExchange) || token != nil || raw != nil {
+		t.Errorf("ExchangeCodeWithVerifierRaw() of a failed exchange = %+v, %v, %v, want %v", token, raw, err, ErrTokenExchange)
+	}
+}
@@ -0,0 +1,197 @@
+package gclientauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Authenticator gets tokens for a client credential, parsing the credential
+// once, for long-running programs that need tokens many times.  The token is
+// cached in the TokenStore set with WithTokenStore or, by default, in the
+// DefaultCachePath of the application.  It is safe for concurrent use.
+type Authenticator struct {
+	config    *oauth2.Config
+	installed bool
+	store     TokenStore
+	o         *options
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// NewAuthenticator returns an Authenticator for the client credential file and
+// scopes.  No token is requested until one is needed.
+func NewAuthenticator(credential string, scopes []string, opts ...Option) (*Authenticator, error) {
+	o := newOptions(opts...)
+	data, err := readCredential(credential, o.credentialEnv, "client credential")
+	if err != nil {
+		return nil, err
+	}
+	config, installed, err := parseCredential(data, scopes)
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		o.useLoopbackRedirect(config, redirectURIs(data))
+	}
+	if o.endpoint != nil {
+		config.Endpoint = *o.endpoint
+	}
+	store, err := o.tokenStore("", config)
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{config: config, installed: installed, store: store, o: o}, nil
+}
+
+// Config returns the oauth2 config of the client credential.
+func (a *Authenticator) Config() *oauth2.Config {
+	return a.config
+}
+
+// Token returns a valid token, getting it like GetGoogleOauth2Token if the
+// current one has expired.
+func (a *Authenticator) Token(ctx context.Context) (*oauth2.Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.validToken(ctx)
+}
+
+// validToken returns a valid token.  a.mu must be held.
+func (a *Authenticator) validToken(ctx context.Context) (*oauth2.Token, error) {
+	if a.o.valid(a.token) {
+		return a.token, nil
+	}
+	ctx = a.o.context(ctx)
+	token, err := cachedToken(ctx, a.config, a.store, a.o, authorizer(ctx, a.config, a.installed, a.o))
+	if err != nil {
+		return nil, err
+	}
+	a.token = token
+	return token, nil
+}
+
+// Client returns an HTTP client that authorizes its requests with the tokens
+// of the Authenticator.  A token is got first so the user is asked to
+// authorize the application now rather than during a request.
+func (a *Authenticator) Client(ctx context.Context) (*http.Client, error) {
+	if _, err := a.Token(ctx); err != nil {
+		return nil, err
+	}
+	return a.o.newClient(ctx, authenticatorSource{ctx: ctx, a: a}), nil
+}
+
+// Refresh gets a new access token with the refresh token even if the current
+// token is still valid, e.g. after the user's permissions changed, and saves
+// it.  The user is never asked to authorize the application: if there is no
+// token with a refresh token, ErrNoRefreshToken is returned.
+func (a *Authenticator) Refresh(ctx context.Context) (*oauth2.Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	current := a.token
+	if current == nil {
+		// The token may have been saved by an earlier run.
+		current, _ = a.store.Load(ctx)
+	}
+	if current == nil || current.RefreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+	token, err := refreshToken(a.o.context(ctx), a.config, current)
+	if err != nil {
+		return nil, fmt.Errorf("unable to refresh the token. %w", err)
+	}
+	token = inheritGrant(token, current)
+	if err := a.store.Save(ctx, token); err != nil {
+		a.o.logger.Printf("(WARNING) Unable to write token to local cache. %v", err)
+	}
+	a.token = token
+	return token, nil
+}
+
+// Revoke revokes the token and removes it from the token store like Logout so
+// the user has to authorize the application again.  The token is forgotten
+// even if revoking it fails.
+func (a *Authenticator) Revoke(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = nil
+	return Logout(a.o.context(ctx), a.store)
+}
+
+// authenticatorSource is the oauth2.TokenSource of the clients returned by
+// Authenticator.Client.
+type authenticatorSource struct {
+	ctx context.Context
+	a   *Authenticator
+}
+
+// Token returns the Authenticator's token.
+func (s authenticatorSource) Token() (*oauth2.Token, error) {
+	return s.a.Token(s.ctx)
+}
+
+// autoRefreshRetry is how long StartAutoRefresh waits before trying again when
+// there is no token to refresh yet or refreshing it failed.
+const autoRefreshRetry = time.Minute
+
+// StartAutoRefresh refreshes the token in the background margin before it
+// expires, and saves it, until ctx is done or the returned stop function is
+// called, so Token never has to wait for a refresh.  The user is never asked
+// to authorize the application: call Token first so there is a token to
+// refresh.  Failed refreshes are logged and tried again after a minute.  The
+// token is refreshed at most once a minute.
+func (a *Authenticator) StartAutoRefresh(ctx context.Context, margin time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	go a.autoRefresh(ctx, margin, sleep)
+	return cancel
+}
+
+// autoRefresh refreshes the token for StartAutoRefresh until ctx is done,
+// waiting with wait until it is due.
+func (a *Authenticator) autoRefresh(ctx context.Context, margin time.Duration, wait func(context.Context, time.Duration) error) {
+	// refreshed is set after a refresh so a margin longer than the lifetime
+	// of tokens can't make it refresh continuously.
+	refreshed := false
+	for {
+		d := a.nextRefresh(ctx, margin)
+		if refreshed && d < autoRefreshRetry {
+			d = autoRefreshRetry
+		}
+		if err := wait(ctx, d); err != nil {
+			return
+		}
+		if a.nextRefresh(ctx, margin) > 0 {
+			// Token got a new token meanwhile.
+			refreshed = false
+			continue
+		}
+		refreshed = true
+		if _, err := a.Refresh(ctx); err != nil && ctx.Err() == nil {
+			a.o.logger.Printf("(WARNING) Unable to refresh the token in the background. %v", err)
+		}
+	}
+}
+
+// nextRefresh returns how long until the token is due to be refreshed margin
+// before it expires, or autoRefreshRetry if there is no token that can be
+// refreshed yet.
+func (a *Authenticator) nextRefresh(ctx context.Context, margin time.Duration) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == nil {
+		// The token may have been saved by an earlier run.
+		a.token, _ = a.store.Load(ctx)
+	}
+	if a.token == nil || a.token.RefreshToken == "" || a.token.Expiry.IsZero() {
+		return autoRefreshRetry
+	}
+	if d := a.token.Expiry.Sub(a.o.now()) - margin; d > 0 {
+		return d
+	}
+	return 0
+}
@@ -0,0 +1,200 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// newTestAuthenticator returns an Authenticator of an installed credential
+// for the fake authorization server that caches its token in store.
+func newTestAuthenticator(t *testing.T, srv *tokenServer, store TokenStore, opts ...Option) *Authenticator {
+	opts = append([]Option{WithTokenStore(store), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n"))}, opts...)
+	a, err := NewAuthenticator(credentialFile(t, installedCredential("client")), []string{"email"}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAuthenticatorToken(t *testing.T) {
+	srv := newTokenServer(t)
+	a := newTestAuthenticator(t, srv, &MemoryTokenStore{})
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := a.Token(context.Background()); err != nil || token.AccessToken != "at" {
+				t.Errorf("Token() = %v, %v, want the token", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := srv.requests("authorization_code"); n != 1 {
+		t.Errorf("%d authorizations, want 1", n)
+	}
+	if a.Config().ClientID != "client" {
+		t.Errorf("Config().ClientID = %q, want client", a.Config().ClientID)
+	}
+}
+
+func TestAuthenticatorRevoke(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+		revokeSrv, ctx := newRevokeServer(t, status, "")
+		store := &MemoryTokenStore{}
+		store.Save(ctx, withScopes(&oauth2.Token{AccessToken: "cached", RefreshToken: "rt", Expiry: time.Now().Add(time.Hour)}, []string{"email"}))
+		srv := newTokenServer(t)
+		a := newTestAuthenticator(t, srv, store)
+		if _, err := a.Token(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		err := a.Revoke(ctx)
+		if (err != nil) != (status != http.StatusOK) {
+			t.Errorf("Revoke() with status %v error = %v", status, err)
+		}
+		if got := revokeSrv.revoked(); len(got) != 1 || got[0] != "rt" {
+			t.Errorf("revoked %q, want the refresh token", got)
+		}
+		if _, err := store.Load(ctx); err == nil {
+			t.Errorf("the token is still in the store after Revoke() with status %v", status)
+		}
+		// The next token needs a new authorization.
+		if token, err := a.Token(context.Background()); err != nil || token.AccessToken != "at" {
+			t.Errorf("Token() after Revoke() = %v, %v, want a new token", token, err)
+		}
+	}
+}
+
+func TestAuthenticatorRefresh(t *testing.T) {
+	ctx := context.Background()
+	srv := newTokenServer(t)
+	store := &MemoryTokenStore{}
+	granted := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	valid := withExtra(withScopes(&oauth2.Token{AccessToken: "cached", RefreshToken: "rt", Expiry: time.Now().Add(time.Hour)}, []string{"email"}), grantedAtKey, granted)
+	store.Save(ctx, valid)
+	a := newTestAuthenticator(t, srv, store)
+
+	token, err := a.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want the refreshed token even though the cached one is valid", token.AccessToken)
+	}
+	if srv.lastForm().Get("refresh_token") != "rt" {
+		t.Errorf("refresh form = %v, want the refresh token", srv.lastForm())
+	}
+	saved, err := store.Load(ctx)
+	if err != nil || saved.AccessToken != "at" {
+		t.Fatalf("saved token = %v, %v, want the refreshed token", saved, err)
+	}
+	if at := grantedAt(saved); !at.Equal(granted) {
+		t.Errorf("grantedAt(saved token) = %v, want the grant of the refreshed token", at)
+	}
+	if token, err := a.Token(ctx); err != nil || token.AccessToken != "at" {
+		t.Errorf("Token() after Refresh() = %v, %v, want the refreshed token", token, err)
+	}
+}
+
+func TestAuthenticatorRefreshWithoutRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	for name, cached := range map[string]*oauth2.Token{
+		"no token":         nil,
+		"no refresh token": {AccessToken: "cached", Expiry: time.Now().Add(time.Hour)},
+	} {
+		srv := newTokenServer(t)
+		store := &MemoryTokenStore{}
+		if cached != nil {
+			store.Save(ctx, cached)
+		}
+		a := newTestAuthenticator(t, srv, store)
+		if _, err := a.Refresh(ctx); !errors.Is(err, ErrNoRefreshToken) {
+			t.Errorf("%v: Refresh() error = %v, want %v", name, err, ErrNoRefreshToken)
+		}
+		if n := len(srv.forms); n != 0 {
+			t.Errorf("%v: %d requests to the token endpoint, want none", name, n)
+		}
+	}
+}
+
+// fakeClock is a clock for WithClock that only moves when it is advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestAuthenticatorAutoRefresh(t *testing.T) {
+	// The tokens of the server expire an hour after the real time.
+	start := time.Now()
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		margin time.Duration
+		want   []time.Duration
+	}{
+		{name: "refreshed margin before the expiry", expiry: 10 * time.Minute, margin: 5 * time.Minute, want: []time.Duration{5 * time.Minute, 50 * time.Minute}},
+		{name: "expired", expiry: -time.Minute, margin: 5 * time.Minute, want: []time.Duration{0, 55 * time.Minute}},
+		// A refreshed token is still due, but it isn't refreshed again
+		// right away.
+		{name: "margin longer than the lifetime", expiry: 10 * time.Minute, margin: 2 * time.Hour, want: []time.Duration{0, autoRefreshRetry}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			srv := newTokenServer(t)
+			store := &MemoryTokenStore{}
+			store.Save(ctx, withScopes(&oauth2.Token{AccessToken: "cached", RefreshToken: "rt", Expiry: start.Add(tt.expiry)}, []string{"email"}))
+			clock := &fakeClock{now: start}
+			a := newTestAuthenticator(t, srv, store, WithClock(clock.Now))
+
+			var waits []time.Duration
+			a.autoRefresh(ctx, tt.margin, func(ctx context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				if len(waits) == len(tt.want) {
+					cancel()
+					return ctx.Err()
+				}
+				clock.advance(d)
+				return nil
+			})
+
+			if len(waits) != len(tt.want) {
+				t.Fatalf("waited %v, want %v", waits, tt.want)
+			}
+			for i, want := range tt.want {
+				// The refreshed token's expiry depends on the real time.
+				if d := waits[i] - want; d < -time.Second || d > time.Second {
+					t.Errorf("wait %d = %v, want %v", i, waits[i], want)
+				}
+			}
+			if n := srv.requests("refresh_token"); n != 1 {
+				t.Errorf("%d refreshes, want 1", n)
+			}
+			if token, err := store.Load(ctx); err != nil || token.AccessToken != "at" {
+				t.Errorf("saved token = %v, %v, want the refreshed token", token, err)
+			}
+		})
+	}
+}
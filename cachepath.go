@@ -0,0 +1,83 @@
+package gclientauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// defaultCacheFile is the name of the token file in the DefaultCachePath
+// directory.
+const defaultCacheFile = "token.json"
+
+// cacheDirMode is the permission of the directories created for token files
+// so other users can't list them.
+const cacheDirMode os.FileMode = 0700
+
+// DefaultCachePath returns the path of the token file for the application in
+// the user's configuration directory (see os.UserConfigDir), e.g.
+// ~/.config/<appName>/token.json on Linux.  On Unix systems other than macOS,
+// $XDG_CONFIG_HOME is used instead of ~/.config if it is set.  $XDG_CACHE_HOME
+// isn't, since it may be cleared and the refresh token would be lost with it.
+// The directory is created if it doesn't exist.
+func DefaultCachePath(appName string) (string, error) {
+	path, err := defaultCachePath(appName)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, cacheDirMode); err != nil {
+		return "", fmt.Errorf("unable to create the cache directory (%v). %w", dir, err)
+	}
+	return path, nil
+}
+
+// defaultCachePath is DefaultCachePath without creating the directory, e.g.
+// for WithDryRun.
+func defaultCachePath(appName string) (string, error) {
+	if appName == "" {
+		return "", fmt.Errorf("unable to build the default cache path, the application name is empty")
+	}
+	base, err := userConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the user's configuration directory. %w", err)
+	}
+	return filepath.Join(base, appName, defaultCacheFile), nil
+}
+
+// userConfigDir returns the directory for the application directories of
+// DefaultCachePath.
+func userConfigDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+	default:
+		// Relative paths are invalid according to the XDG Base Directory
+		// Specification and must be ignored.
+		if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+			return dir, nil
+		}
+		// os.UserConfigDir fails instead of ignoring a relative
+		// $XDG_CONFIG_HOME.
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".config"), nil
+	}
+	return os.UserConfigDir()
+}
+
+// ScopedCacheFile returns the name of the token file for the client ID and
+// scopes in a cache directory, token-<hash>.json, so tokens for different sets
+// of scopes don't replace each other.  The order of the scopes doesn't matter.
+func ScopedCacheFile(clientID string, scopes []string) string {
+	sorted := append([]string(nil), scopes...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(clientID + "\n" + strings.Join(sorted, " ")))
+	return "token-" + hex.EncodeToString(sum[:6]) + ".json"
+}
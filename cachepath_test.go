@@ -0,0 +1,119 @@
+package gclientauth
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDefaultCachePath(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skipf("$XDG_CONFIG_HOME isn't used and permissions differ on %v", runtime.GOOS)
+	}
+	base := t.TempDir()
+	setenv(t, "XDG_CONFIG_HOME", base)
+
+	path, err := DefaultCachePath("app")
+	if err != nil {
+		t.Fatalf("DefaultCachePath() error = %v", err)
+	}
+	if want := filepath.Join(base, "app", "token.json"); path != want {
+		t.Errorf("DefaultCachePath() = %q, want %q", path, want)
+	}
+	fi, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("the directory wasn't created: %v", err)
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != 0700 {
+		t.Errorf("directory mode = %v, want a directory with 0700", fi.Mode())
+	}
+}
+
+// Tokens aren't kept in $XDG_CACHE_HOME, which may be cleared.
+func TestDefaultCachePathIgnoresXDGCacheHome(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skipf("$XDG_CONFIG_HOME isn't used on %v", runtime.GOOS)
+	}
+	home := t.TempDir()
+	setenv(t, "HOME", home)
+	setenv(t, "XDG_CONFIG_HOME", "")
+	setenv(t, "XDG_CACHE_HOME", t.TempDir())
+
+	path, err := DefaultCachePath("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, ".config", "app", "token.json"); path != want {
+		t.Errorf("DefaultCachePath() = %q, want %q", path, want)
+	}
+}
+
+func TestDefaultCachePathRelativeXDG(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skipf("$XDG_CONFIG_HOME isn't used on %v", runtime.GOOS)
+	}
+	home := t.TempDir()
+	setenv(t, "HOME", home)
+	setenv(t, "XDG_CONFIG_HOME", "relative")
+
+	// Relative directories are ignored.
+	path, err := DefaultCachePath("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, ".config", "app", "token.json"); path != want {
+		t.Errorf("DefaultCachePath() = %q, want %q", path, want)
+	}
+}
+
+func TestDefaultCachePathNoAppName(t *testing.T) {
+	if path, err := DefaultCachePath(""); err == nil {
+		t.Errorf("DefaultCachePath(\"\") = %q, want an error", path)
+	}
+}
+
+func TestScopedCacheFile(t *testing.T) {
+	name := ScopedCacheFile("client", []string{"email", "profile"})
+	if !strings.HasPrefix(name, "token-") || filepath.Ext(name) != ".json" {
+		t.Errorf("ScopedCacheFile() = %q, want token-<hash>.json", name)
+	}
+	if got := ScopedCacheFile("client", []string{"profile", "email"}); got != name {
+		t.Errorf("ScopedCacheFile() of reordered scopes = %q, want %q", got, name)
+	}
+	for _, other := range []string{ScopedCacheFile("client", []string{"email"}), ScopedCacheFile("other", []string{"email", "profile"})} {
+		if other == name {
+			t.Errorf("ScopedCacheFile() = %q for different scopes or clients", other)
+		}
+	}
+}
+
+// Tokens for different scopes in a cache directory don't replace each other.
+func TestCacheDirectoryIsScoped(t *testing.T) {
+	ctx := context.Background()
+	srv := newTokenServer(t)
+	dir := t.TempDir()
+	for _, scopes := range [][]string{{"email"}, {"email", "profile"}} {
+		_, _, err := GetGoogleOauth2TokenFromJSON(ctx, installedCredential("client"), dir, scopes,
+			WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")))
+		if err != nil {
+			t.Fatalf("GetGoogleOauth2TokenFromJSON(%q) error = %v", scopes, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ScopedCacheFile("client", scopes))); err != nil {
+			t.Errorf("the token for %q isn't in its file: %v", scopes, err)
+		}
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("%d files in the cache directory, want one for each set of scopes", len(files))
+	}
+}
@@ -0,0 +1,47 @@
+package gclientauth
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// copyToClipboard copies the text to the system clipboard with the platform's
+// clipboard command.
+func copyToClipboard(text string) error {
+	cmd, err := clipboardCommand(runtime.GOOS, os.Getenv("WAYLAND_DISPLAY") != "", exec.LookPath)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// clipboardCommand returns the command that copies its input to the clipboard
+// on goos: pbcopy on macOS, clip on Windows and on other systems the first of
+// wl-copy on Wayland, then xclip and xsel for X11 and clip.exe on WSL that
+// lookPath finds.
+func clipboardCommand(goos string, wayland bool, lookPath func(string) (string, error)) (*exec.Cmd, error) {
+	switch goos {
+	case "darwin":
+		return exec.Command("pbcopy"), nil
+	case "windows":
+		return exec.Command("clip"), nil
+	}
+	candidates := [][]string{
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+		{"clip.exe"},
+	}
+	if wayland {
+		candidates = append([][]string{{"wl-copy"}}, candidates...)
+	}
+	for _, c := range candidates {
+		if path, err := lookPath(c[0]); err == nil {
+			return exec.Command(path, c[1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("Cannot copy to the clipboard, none of wl-copy, xclip, xsel or clip.exe found")
+}
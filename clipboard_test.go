@@ -0,0 +1,79 @@
+package gclientauth
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClipboardCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		goos     string
+		wayland  bool
+		commands []string
+		want     []string
+	}{
+		{name: "darwin", goos: "darwin", want: []string{"pbcopy"}},
+		{name: "windows", goos: "windows", want: []string{"clip"}},
+		{name: "wayland", goos: "linux", wayland: true, commands: []string{"wl-copy", "xclip"}, want: []string{"/usr/bin/wl-copy"}},
+		{name: "x11", goos: "linux", commands: []string{"wl-copy", "xclip", "xsel"}, want: []string{"/usr/bin/xclip", "-selection", "clipboard"}},
+		{name: "xsel", goos: "freebsd", commands: []string{"xsel"}, want: []string{"/usr/bin/xsel", "--clipboard", "--input"}},
+		{name: "wsl", goos: "linux", commands: []string{"clip.exe"}, want: []string{"/usr/bin/clip.exe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := clipboardCommand(tt.goos, tt.wayland, lookPathOf(tt.commands...))
+			if err != nil {
+				t.Fatalf("clipboardCommand() error = %v", err)
+			}
+			if !reflect.DeepEqual(cmd.Args, tt.want) {
+				t.Errorf("clipboardCommand() args = %q, want %q", cmd.Args, tt.want)
+			}
+		})
+	}
+	if cmd, err := clipboardCommand("linux", true, noLookPath); err == nil {
+		t.Errorf("clipboardCommand() without commands = %q, want an error", cmd.Args)
+	}
+}
+
+func TestShowURLClipboard(t *testing.T) {
+	const authURL = "https://accounts.example.com/auth"
+	tests := []struct {
+		name      string
+		clipboard bool
+		err       error
+		want      string
+	}{
+		{name: "disabled"},
+		{name: "copied", clipboard: true, want: "The URL has been copied to the clipboard."},
+		{name: "failed", clipboard: true, err: errors.New("no clipboard")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			logger := &recordingLogger{}
+			o := newOptions(WithClipboard(tt.clipboard), WithPromptWriter(&out), WithLogger(logger))
+			var copied []string
+			o.copyText = func(text string) error {
+				copied = append(copied, text)
+				return tt.err
+			}
+			o.showURL(authURL)
+
+			if !tt.clipboard && copied != nil {
+				t.Errorf("copied %q with the clipboard disabled", copied)
+			}
+			if tt.clipboard && !reflect.DeepEqual(copied, []string{authURL}) {
+				t.Errorf("copied %q, want the URL", copied)
+			}
+			if got := strings.Contains(out.String(), "copied to the clipboard"); got != (tt.want != "") {
+				t.Errorf("prompt = %q, want the note %q", out.String(), tt.want)
+			}
+			if tt.err != nil && !logger.contains("Unable to copy the authorization URL to the clipboard. no clipboard") {
+				t.Errorf("logged %q, want the error", logger.lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package gclientauth
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// NewConfig returns the oauth2 config for the client credential file without
+// getting a token, e.g. to build the authorization URL with GetAuthURL.
+func NewConfig(credential string, scopes []string) (*oauth2.Config, error) {
+	data, err := readCredential(credential, defaultCredentialEnv, "client credential")
+	if err != nil {
+		return nil, err
+	}
+	return NewConfigFromJSON(data, scopes)
+}
+
+// NewConfigFromJSON is like NewConfig but takes the contents of the client
+// credential file.
+func NewConfigFromJSON(data []byte, scopes []string) (*oauth2.Config, error) {
+	config, _, err := parseCredential(data, scopes)
+	return config, err
+}
+
+// parseCredential returns the oauth2 config for the client credential JSON
+// and whether it is a desktop/other (installed) credential rather than a web
+// application credential.
+func parseCredential(data []byte, scopes []string) (*oauth2.Config, bool, error) {
+	type cred struct {
+	}
+
+	var credtype struct {
+		Web       *cred `json:"web"`
+		Installed *cred `json:"installed"`
+	}
+
+	if isServiceAccount(data) {
+		return nil, false, withSentinel(ErrInvalidCredential, "credential is a service account, use GetServiceAccountToken instead")
+	}
+	if err := json.Unmarshal(data, &credtype); err != nil {
+		return nil, false, withSentinel(ErrInvalidCredential, "error parsing credential file. %w", err)
+	}
+	if credtype.Web == nil && credtype.Installed == nil {
+		return nil, false, withSentinel(ErrUnknownCredentialType, "credential has neither a web nor an installed client, found %v", credentialKeys(data))
+	}
+
+	scopes, err := cleanScopes(scopes)
+	if err != nil {
+		return nil, false, err
+	}
+	config, err := google.ConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, false, withSentinel(ErrInvalidCredential, "error parsing credential file. %w", err)
+	}
+	return config, credtype.Installed != nil, nil
+}
+
+// redirectURIs returns the redirect URIs of the web application credential
+// JSON.
+func redirectURIs(data []byte) []string {
+	var credtype struct {
+		Web struct {
+			RedirectURIs []string `json:"redirect_uris"`
+		} `json:"web"`
+	}
+	json.Unmarshal(data, &credtype)
+	return credtype.Web.RedirectURIs
+}
+
+// useLoopbackRedirect sets the RedirectURL of the config of a web application
+// credential to the first of its redirect URIs whose loopback host and port the
+// local web server can listen on, or to the first loopback URI if none can be
+// listened on, so the browser isn't redirected to a host the server isn't on.
+// The config is left alone if none of the URIs are loopback.
+func (o *options) useLoopbackRedirect(config *oauth2.Config, uris []string) {
+	first := ""
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !isLoopback(u.Hostname()) {
+			continue
+		}
+		if first == "" {
+			first = uri
+		}
+		// The port of the URI isn't used with WithListener and isn't
+		// listened on in a dry run.
+		if o.listener != nil || o.dryRun || canListen(o.listenHost(u.Hostname()), o.listenPort(u)) {
+			config.RedirectURL = uri
+			return
+		}
+	}
+	if first != "" {
+		config.RedirectURL = first
+	}
+}
+
+// defaultCredentialEnv is the environment variable with the path of the
+// credential file used when no file is given, as for other Google tools.
+const defaultCredentialEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// readCredential returns the contents of the credential file or, if
+// credential is empty, of the file named by the environment variable env.
+// kind describes the credential for the error messages.
+func readCredential(credential, env, kind string) ([]byte, error) {
+	if credential == "" {
+		if credential = os.Getenv(env); credential == "" {
+			return nil, withSentinel(ErrNoCredentialFile, "no %v file given and $%v isn't set", kind, env)
+		}
+	}
+	data, err := os.ReadFile(credential)
+	if err != nil {
+		return nil, withSentinel(ErrNoCredentialFile, "unable to read %v file (%v). %w", kind, credential, err)
+	}
+	return data, nil
+}
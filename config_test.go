@@ -0,0 +1,169 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestNewConfigFromJSONUnknownType(t *testing.T) {
+	_, err := NewConfigFromJSON([]byte(`{"other":{"client_id":"c"},"extra":1}`), []string{"email"})
+	if !errors.Is(err, ErrUnknownCredentialType) {
+		t.Fatalf("NewConfigFromJSON() error = %v, want %v", err, ErrUnknownCredentialType)
+	}
+	if !strings.Contains(err.Error(), "[extra other]") {
+		t.Errorf("error = %q, want the keys of the credential", err)
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		credential   []byte
+		wantClientID string
+		wantRedirect string
+	}{
+		{name: "web", credential: webCredential("http://localhost:8080/cb"), wantClientID: "web-client", wantRedirect: "http://localhost:8080/cb"},
+		{name: "installed", credential: installedCredential("desktop-client"), wantClientID: "desktop-client", wantRedirect: "urn:ietf:wg:oauth:2.0:oob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewConfig(credentialFile(t, tt.credential), []string{"email", "profile"})
+			if err != nil {
+				t.Fatalf("NewConfig() error = %v", err)
+			}
+			if config.ClientID != tt.wantClientID || config.ClientSecret != "secret" {
+				t.Errorf("client = %q, %q, want %q, secret", config.ClientID, config.ClientSecret, tt.wantClientID)
+			}
+			if config.RedirectURL != tt.wantRedirect {
+				t.Errorf("RedirectURL = %q, want %q", config.RedirectURL, tt.wantRedirect)
+			}
+			if config.Endpoint.TokenURL != "https://accounts.example.com/token" {
+				t.Errorf("TokenURL = %q, want the one of the credential", config.Endpoint.TokenURL)
+			}
+			fromJSON, err := NewConfigFromJSON(tt.credential, []string{"email", "profile"})
+			if err != nil || !reflect.DeepEqual(fromJSON, config) {
+				t.Errorf("NewConfigFromJSON() = %+v, %v, want %+v", fromJSON, err, config)
+			}
+		})
+	}
+}
+
+func TestNewConfigMissingFile(t *testing.T) {
+	if _, err := NewConfig(filepath.Join(t.TempDir(), "missing.json"), nil); !errors.Is(err, ErrNoCredentialFile) {
+		t.Errorf("NewConfig() error = %v, want %v", err, ErrNoCredentialFile)
+	}
+}
+
+func TestCredentialFromEnv(t *testing.T) {
+	ctx := context.Background()
+	cached := withScopes(&oauth2.Token{AccessToken: "cached", Expiry: time.Now().Add(time.Hour)}, []string{"email"})
+	token := func(opts ...Option) (*oauth2.Config, error) {
+		store := &MemoryTokenStore{}
+		store.Save(ctx, cached)
+		_, config, err := GetGoogleOauth2Token(ctx, "", "", []string{"email"}, append([]Option{WithTokenStore(store)}, opts...)...)
+		return config, err
+	}
+
+	setenv(t, "GOOGLE_APPLICATION_CREDENTIALS", credentialFile(t, installedCredential("from-env")))
+	if config, err := token(); err != nil || config.ClientID != "from-env" {
+		t.Errorf("GetGoogleOauth2Token() = %v, %v, want the config of $GOOGLE_APPLICATION_CREDENTIALS", config, err)
+	}
+
+	setenv(t, "MY_CREDENTIAL", credentialFile(t, installedCredential("from-my-env")))
+	if config, err := token(WithCredentialEnv("MY_CREDENTIAL")); err != nil || config.ClientID != "from-my-env" {
+		t.Errorf("GetGoogleOauth2Token(WithCredentialEnv) = %v, %v, want the config of $MY_CREDENTIAL", config, err)
+	}
+
+	setenv(t, "GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := token(); !errors.Is(err, ErrNoCredentialFile) || !strings.Contains(err.Error(), "missing.json") {
+		t.Errorf("GetGoogleOauth2Token() with a missing file error = %v, want %v naming the file", err, ErrNoCredentialFile)
+	}
+
+	os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if _, err := token(); !errors.Is(err, ErrNoCredentialFile) || !strings.Contains(err.Error(), "$GOOGLE_APPLICATION_CREDENTIALS") {
+		t.Errorf("GetGoogleOauth2Token() without the variable error = %v, want %v naming the variable", err, ErrNoCredentialFile)
+	}
+}
+
+// busyPort returns a loopback port that is listened on until the test ends.
+func busyPort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// freePort returns a loopback port that nothing listens on.
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestUseLoopbackRedirect(t *testing.T) {
+	busy, free := "http://localhost:"+busyPort(t)+"/cb", "http://localhost:"+freePort(t)+"/cb"
+	const remote = "https://app.example.com/oauth2callback"
+	tests := []struct {
+		name string
+		uris []string
+		opts []Option
+		want string
+	}{
+		{name: "loopback after a remote URI", uris: []string{remote, free}, want: free},
+		{name: "free after a busy port", uris: []string{busy, remote, free}, want: free},
+		{name: "all busy", uris: []string{remote, busy}, want: busy},
+		{name: "no loopback", uris: []string{remote, "https://other.example.com/cb"}, want: "original"},
+		{name: "not http", uris: []string{"urn:ietf:wg:oauth:2.0:oob", "ftp://localhost/cb", "://bad", free}, want: free},
+		{name: "none", want: "original"},
+		{name: "with a port", uris: []string{remote, busy, free}, opts: []Option{WithPort("0")}, want: free},
+		{name: "with a port for URIs without one", uris: []string{remote, busy, "http://localhost/cb"}, opts: []Option{WithPort("0")}, want: "http://localhost/cb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &oauth2.Config{RedirectURL: "original"}
+			newOptions(tt.opts...).useLoopbackRedirect(config, tt.uris)
+			if config.RedirectURL != tt.want {
+				t.Errorf("RedirectURL = %q, want %q", config.RedirectURL, tt.want)
+			}
+		})
+	}
+}
+
+// The browser is redirected to the loopback URI the web server listens on,
+// not to the first URI of the credential.
+func TestWebFlowPicksLoopbackRedirect(t *testing.T) {
+	srv := newTokenServer(t)
+	free := "http://localhost:" + freePort(t) + "/cb"
+	credential := webCredential("https://app.example.com/oauth2callback", "http://localhost:"+busyPort(t)+"/cb", free)
+	redirects := make(chan string, 1)
+	_, config, err := GetGoogleOauth2TokenFromJSON(context.Background(), credential, cachePath(t), []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithBrowserOpener(redirectingBrowser(t, "code=c", redirects)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if got := <-redirects; got != free {
+		t.Errorf("redirected to %q, want %q", got, free)
+	}
+	if config.RedirectURL != free {
+		t.Errorf("RedirectURL = %q, want %q", config.RedirectURL, free)
+	}
+	if got := srv.lastForm().Get("redirect_uri"); got != free {
+		t.Errorf("redirect_uri of the exchange = %q, want %q", got, free)
+	}
+}
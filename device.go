@@ -0,0 +1,203 @@
+package gclientauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// googleDeviceAuthURL is Google's device authorization endpoint.
+	googleDeviceAuthURL = "https://oauth2.googleapis.com/device/code"
+
+	// deviceGrantType is the grant type for polling the token endpoint in
+	// the device authorization grant (RFC 8628).
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// defaultDeviceInterval is how often to poll for the token if the
+	// authorization server doesn't say.
+	defaultDeviceInterval = 5 * time.Second
+
+	// defaultDeviceLifetime is how long the device code is valid if the
+	// authorization server doesn't say, as long as Google's codes are.
+	defaultDeviceLifetime = 30 * time.Minute
+)
+
+// deviceAuth is the response of the device authorization endpoint.
+type deviceAuth struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+}
+
+// verification returns the URL the user has to visit to enter the user code.
+func (d *deviceAuth) verification() string {
+	if d.VerificationURL != "" {
+		return d.VerificationURL
+	}
+	return d.VerificationURI
+}
+
+// getDeviceAuth starts the device authorization grant at the device
+// authorization endpoint deviceURL.
+func getDeviceAuth(ctx context.Context, config *oauth2.Config, deviceURL string) (*deviceAuth, error) {
+	status, body, err := postForm(ctx, deviceURL, url.Values{
+		"client_id": {config.ClientID},
+		"scope":     {strings.Join(config.Scopes, " ")},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to start device authorization. %w", err)
+	}
+	var da deviceAuth
+	if err := json.Unmarshal(body, &da); err != nil || status != http.StatusOK || da.DeviceCode == "" {
+		return nil, fmt.Errorf("unable to start device authorization (status %v). %s", status, body)
+	}
+	return &da, nil
+}
+
+// pollDeviceToken polls the token endpoint until the user has authorized the
+// device, the device code expires or ctx is done.  wait waits between the
+// polls and the device code expires once the waits add up to its lifetime,
+// or defaultDeviceLifetime if the server doesn't say, so the polling and the
+// expiry follow the same clock.  now returns the current time for the expiry
+// of the token.
+func pollDeviceToken(ctx context.Context, config *oauth2.Config, da *deviceAuth, now func() time.Time, wait func(context.Context, time.Duration) error) (*oauth2.Token, error) {
+	interval := time.Duration(da.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDeviceInterval
+	}
+	lifetime := time.Duration(da.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultDeviceLifetime
+	}
+
+	// The interval grows with slow_down so each wait is added once it is
+	// over.
+	var waited time.Duration
+	for {
+		if waited+interval > lifetime {
+			return nil, ErrDeviceCodeExpired
+		}
+		if err := wait(ctx, interval); err != nil {
+			return nil, err
+		}
+		waited += interval
+
+		var resp struct {
+			AccessToken  string `json:"access_token"`
+			TokenType    string `json:"token_type"`
+			RefreshToken string `json:"refresh_token"`
+			ExpiresIn    int64  `json:"expires_in"`
+			Error        string `json:"error"`
+		}
+		var raw map[string]interface{}
+		_, body, err := postForm(ctx, config.Endpoint.TokenURL, url.Values{
+			"client_id":     {config.ClientID},
+			"client_secret": {config.ClientSecret},
+			"device_code":   {da.DeviceCode},
+			"grant_type":    {deviceGrantType},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the device token. %w", err)
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("unable to decode the device token. %w", err)
+		}
+		json.Unmarshal(body, &raw)
+
+		switch resp.Error {
+		case "":
+			token := &oauth2.Token{
+				AccessToken:  resp.AccessToken,
+				TokenType:    resp.TokenType,
+				RefreshToken: resp.RefreshToken,
+			}
+			if resp.ExpiresIn > 0 {
+				token.Expiry = now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+			}
+			return token.WithExtra(raw), nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "expired_token":
+			return nil, ErrDeviceCodeExpired
+		case "access_denied":
+			return nil, ErrAuthDenied
+		default:
+			return nil, fmt.Errorf("unable to get the device token. %v", resp.Error)
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done, in which case it returns the
+// context's error.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetDeviceToken returns an access token and the oauth2 config for the client
+// credential file using the device authorization grant (RFC 8628) for devices
+// without a browser.  The user is shown a code to enter at a URL on another
+// device and the token is polled for until the user has done so or the code
+// expires, in which case ErrDeviceCodeExpired is returned.
+//
+// The credential must be for a "TVs and Limited Input devices" client.  The
+// device authorization endpoint is Google's unless set with
+// WithDeviceAuthURL.  ErrAuthDenied is returned if the user denies access.  Like
+// GetGoogleOauth2Token, a valid token is read from the cachedtoken file and the
+// new token is saved.
+func GetDeviceToken(ctx context.Context, credential, cachedtoken string, scopes []string, opts ...Option) (*oauth2.Token, *oauth2.Config, error) {
+	o := newOptions(opts...)
+	ctx = o.context(ctx)
+
+	data, err := readCredential(credential, o.credentialEnv, "client credential")
+	if err != nil {
+		return nil, nil, err
+	}
+	scopes, err = cleanScopes(scopes)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := google.ConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, nil, withSentinel(ErrInvalidCredential, "error parsing credential file. %w", err)
+	}
+	if o.endpoint != nil {
+		config.Endpoint = *o.endpoint
+	}
+
+	store, err := o.tokenStore(cachedtoken, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err := cachedToken(ctx, config, store, o, func() (*oauth2.Token, error) {
+		da, err := getDeviceAuth(ctx, config, o.deviceAuthURL)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(o.promptWriter(), "Visit the URL on another device: \n\t%v\nand enter the code: %v\n", o.link(da.verification()), da.UserCode)
+		o.showQRCode(da.verification())
+		return pollDeviceToken(ctx, config, da, o.now, sleep)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, config, nil
+}
@@ -0,0 +1,168 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// deviceServer returns a fake authorization server whose token endpoint
+// responds to the polls with the errors in turn and then with the token.
+func deviceServer(t *testing.T, errs ...string) *tokenServer {
+	srv := newTokenServer(t)
+	srv.respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/device" {
+			io.WriteString(w, `{"device_code":"dc","user_code":"UC","verification_url":"https://example.com/device","expires_in":1800,"interval":1}`)
+			return
+		}
+		if len(errs) == 0 {
+			io.WriteString(w, tokenResponse)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"`+errs[0]+`"}`)
+		errs = errs[1:]
+	}
+	return srv
+}
+
+// recordWaits returns a wait for pollDeviceToken that returns immediately and
+// appends the durations to waits.
+func recordWaits(waits *[]time.Duration) func(context.Context, time.Duration) error {
+	return func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+}
+
+func TestGetDeviceAuth(t *testing.T) {
+	srv := deviceServer(t)
+	config := &oauth2.Config{ClientID: "client", Scopes: []string{"email", "profile"}}
+	da, err := getDeviceAuth(context.Background(), config, srv.URL+"/device")
+	if err != nil {
+		t.Fatalf("getDeviceAuth() error = %v", err)
+	}
+	if da.DeviceCode != "dc" || da.UserCode != "UC" || da.verification() != "https://example.com/device" {
+		t.Errorf("getDeviceAuth() = %+v", da)
+	}
+	if f := srv.lastForm(); f.Get("client_id") != "client" || f.Get("scope") != "email profile" {
+		t.Errorf("device authorization form = %v", f)
+	}
+}
+
+func TestPollDeviceToken(t *testing.T) {
+	srv := deviceServer(t, "authorization_pending", "slow_down")
+	var waits []time.Duration
+	da := &deviceAuth{DeviceCode: "dc", ExpiresIn: 1800, Interval: 1}
+	token, err := pollDeviceToken(context.Background(), &oauth2.Config{ClientID: "client", Endpoint: srv.endpoint()}, da, time.Now, recordWaits(&waits))
+	if err != nil {
+		t.Fatalf("pollDeviceToken() error = %v", err)
+	}
+	if token.AccessToken != "at" || token.RefreshToken != "rt" {
+		t.Errorf("pollDeviceToken() = %+v, want the token", token)
+	}
+	// slow_down adds 5 seconds to the interval.
+	if want := []time.Duration{time.Second, time.Second, 6 * time.Second}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+	if f := srv.lastForm(); f.Get("grant_type") != deviceGrantType || f.Get("device_code") != "dc" {
+		t.Errorf("poll form = %v", f)
+	}
+}
+
+func TestPollDeviceTokenErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		errs []string
+		want error
+	}{
+		{name: "expired_token", errs: []string{"expired_token"}, want: ErrDeviceCodeExpired},
+		{name: "access_denied", errs: []string{"authorization_pending", "access_denied"}, want: ErrAuthDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := deviceServer(t, tt.errs...)
+			var waits []time.Duration
+			da := &deviceAuth{DeviceCode: "dc", ExpiresIn: 1800, Interval: 1}
+			_, err := pollDeviceToken(context.Background(), &oauth2.Config{Endpoint: srv.endpoint()}, da, time.Now, recordWaits(&waits))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("pollDeviceToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollDeviceTokenExpiresWithFixedClock(t *testing.T) {
+	srv := deviceServer(t, "authorization_pending", "authorization_pending", "authorization_pending", "authorization_pending")
+	fixed := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	da := &deviceAuth{DeviceCode: "dc", ExpiresIn: 10, Interval: 5}
+	_, err := pollDeviceToken(context.Background(), &oauth2.Config{Endpoint: srv.endpoint()}, da, func() time.Time { return fixed }, recordWaits(&waits))
+	if !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Fatalf("pollDeviceToken() error = %v, want %v", err, ErrDeviceCodeExpired)
+	}
+	if len(waits) != 2 {
+		t.Errorf("%d polls, want 2 within the 10 seconds of the code", len(waits))
+	}
+}
+
+// Without expires_in the code is polled for as long as Google's codes last.
+func TestPollDeviceTokenNoLifetime(t *testing.T) {
+	srv := deviceServer(t, "authorization_pending")
+	var waits []time.Duration
+	da := &deviceAuth{DeviceCode: "dc", Interval: 1}
+	token, err := pollDeviceToken(context.Background(), &oauth2.Config{Endpoint: srv.endpoint()}, da, time.Now, recordWaits(&waits))
+	if err != nil || token.AccessToken != "at" {
+		t.Fatalf("pollDeviceToken() = %+v, %v, want the token", token, err)
+	}
+	if len(waits) != 2 {
+		t.Errorf("%d polls, want 2", len(waits))
+	}
+
+	pending := make([]string, 31)
+	for i := range pending {
+		pending[i] = "authorization_pending"
+	}
+	srv = deviceServer(t, pending...)
+	waits = nil
+	da = &deviceAuth{DeviceCode: "dc", Interval: 60}
+	if _, err := pollDeviceToken(context.Background(), &oauth2.Config{Endpoint: srv.endpoint()}, da, time.Now, recordWaits(&waits)); !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Fatalf("pollDeviceToken() error = %v, want %v", err, ErrDeviceCodeExpired)
+	}
+	if len(waits) != 30 {
+		t.Errorf("%d polls a minute apart, want 30 within %v", len(waits), defaultDeviceLifetime)
+	}
+}
+
+// The waits before slow_down count with the interval they were made with, not
+// the larger one.
+func TestPollDeviceTokenSlowDownExpiry(t *testing.T) {
+	srv := deviceServer(t, "slow_down", "authorization_pending", "authorization_pending")
+	var waits []time.Duration
+	da := &deviceAuth{DeviceCode: "dc", ExpiresIn: 10, Interval: 1}
+	_, err := pollDeviceToken(context.Background(), &oauth2.Config{Endpoint: srv.endpoint()}, da, time.Now, recordWaits(&waits))
+	if !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Fatalf("pollDeviceToken() error = %v, want %v", err, ErrDeviceCodeExpired)
+	}
+	// 1s and then 6s fit in the 10 seconds of the code, another 6s doesn't.
+	if want := []time.Duration{time.Second, 6 * time.Second}; !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+}
+
+func TestPollDeviceTokenContextDone(t *testing.T) {
+	srv := deviceServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	da := &deviceAuth{DeviceCode: "dc", ExpiresIn: 1800, Interval: 1}
+	if _, err := pollDeviceToken(ctx, &oauth2.Config{Endpoint: srv.endpoint()}, da, time.Now, sleep); !errors.Is(err, context.Canceled) {
+		t.Errorf("pollDeviceToken() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,129 @@
+package gclientauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+)
+
+// The encrypted token file is laid out as:
+//
+//	magic | salt | nonce | AES-GCM ciphertext of the token JSON
+const (
+	encryptedMagic = "gca1"
+	saltSize       = 16
+
+	// scrypt parameters recommended for interactive logins.
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// EncryptedFileTokenStore is a TokenStore that keeps the token in the file at
+// Path encrypted with AES-GCM.  The key is derived from Passphrase with scrypt
+// using a random salt that is stored in the file along with the nonce.
+//
+// Use it with WithTokenStore to avoid leaving the refresh token in plain text.
+type EncryptedFileTokenStore struct {
+	Path       string
+	Passphrase []byte
+}
+
+// Load reads and decrypts the token from the file.  It returns an error if the
+// passphrase is wrong or the file has been modified.
+func (s EncryptedFileTokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	data, err := readTokenFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		return nil, withSentinel(ErrCorruptCache, "token file (%v) is not an encrypted token file", s.Path)
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < saltSize {
+		return nil, withSentinel(ErrCorruptCache, "token file (%v) is truncated", s.Path)
+	}
+	salt, data := data[:saltSize], data[saltSize:]
+
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, withSentinel(ErrCorruptCache, "token file (%v) is truncated", s.Path)
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(encryptedMagic))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt token file (%v), the passphrase may be wrong. %w", s.Path, err)
+	}
+
+	token, migrated, err := decodeToken(plaintext)
+	if err != nil {
+		return nil, decodeError(fmt.Sprintf("token file (%v)", s.Path), err)
+	}
+	if migrated {
+		// The token can still be used if it can't be rewritten.
+		s.Save(ctx, token)
+	}
+	return token, nil
+}
+
+// Save encrypts the token with a new salt and nonce and writes it to the file.
+func (s EncryptedFileTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	plaintext, err := encodeToken(token)
+	if err != nil {
+		return fmt.Errorf("unable to encode the token. %w", err)
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return fmt.Errorf("unable to generate salt. %w", err)
+	}
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("unable to generate nonce. %w", err)
+	}
+
+	data := append([]byte(encryptedMagic), salt...)
+	data = append(data, nonce...)
+	data = gcm.Seal(data, nonce, plaintext, []byte(encryptedMagic))
+	if err := writeFileAtomic(s.Path, data, defaultTokenFileMode); err != nil {
+		return fmt.Errorf("unable to write token file (%v). %w", s.Path, err)
+	}
+	return nil
+}
+
+// Delete removes the token file.  It isn't an error if there is no file.
+func (s EncryptedFileTokenStore) Delete(ctx context.Context) error {
+	return removeTokenFile(s.Path)
+}
+
+// cipher returns the AES-GCM cipher for the key derived from the passphrase
+// and salt.
+func (s EncryptedFileTokenStore) cipher(salt []byte) (cipher.AEAD, error) {
+	if len(s.Passphrase) == 0 {
+		return nil, errors.New("a passphrase is required to encrypt the token file")
+	}
+	key, err := scrypt.Key(s.Passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key from passphrase. %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher. %w", err)
+	}
+	return cipher.NewGCM(block)
+}
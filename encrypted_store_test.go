@@ -0,0 +1,55 @@
+package gclientauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestEncryptedFileTokenStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := EncryptedFileTokenStore{Path: cachePath(t), Passphrase: []byte("correct horse")}
+	if err := store.Save(ctx, &oauth2.Token{AccessToken: "secret-access", RefreshToken: "secret-refresh"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	data, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret-refresh")) {
+		t.Error("the token file has the refresh token in plain text")
+	}
+	token, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if token.AccessToken != "secret-access" || token.RefreshToken != "secret-refresh" {
+		t.Errorf("Load() = %+v, want the saved token", token)
+	}
+}
+
+func TestEncryptedFileTokenStoreWrongPassphrase(t *testing.T) {
+	ctx := context.Background()
+	path := cachePath(t)
+	if err := (EncryptedFileTokenStore{Path: path, Passphrase: []byte("right")}).Save(ctx, &oauth2.Token{AccessToken: "at"}); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := (EncryptedFileTokenStore{Path: path, Passphrase: []byte("wrong")}).Load(ctx); err == nil {
+		t.Errorf("Load() = %+v, want an error", token)
+	}
+}
+
+func TestEncryptedFileTokenStoreNotEncrypted(t *testing.T) {
+	ctx := context.Background()
+	path := cachePath(t)
+	if err := (FileTokenStore{Path: path}).Save(ctx, &oauth2.Token{AccessToken: "at"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (EncryptedFileTokenStore{Path: path, Passphrase: []byte("p")}).Load(ctx); !errors.Is(err, ErrCorruptCache) {
+		t.Errorf("Load() error = %v, want %v", err, ErrCorruptCache)
+	}
+}
@@ -0,0 +1,107 @@
+package gclientauth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoCredentialFile is returned when the client credential file can't be
+// read.
+var ErrNoCredentialFile = errors.New("unable to read credential file")
+
+// ErrInvalidCredential is returned when the client credential can't be parsed
+// or isn't the kind of credential expected.
+var ErrInvalidCredential = errors.New("invalid credential")
+
+// ErrUnknownCredentialType is returned when the client credential is neither
+// for a web application nor for a desktop/other (installed) application.
+var ErrUnknownCredentialType = errors.New("unknown credential type")
+
+// ErrTokenExchange is returned when the authorization code can't be exchanged
+// for a token.
+var ErrTokenExchange = errors.New("unable to exchange the authorization code for a token")
+
+// ErrNoCode is returned when no authorization code was received.
+var ErrNoCode = errors.New("no authorization code")
+
+// ErrStateMismatch is returned when the state of an authorization response
+// doesn't match the state sent with the authorization request, which means the
+// response may have been forged.
+var ErrStateMismatch = errors.New("state of the authorization response doesn't match the request")
+
+// ErrDeviceCodeExpired is returned when the user doesn't authorize the device
+// before the code shown to them expires.
+var ErrDeviceCodeExpired = errors.New("device code expired before it was authorized")
+
+// ErrNonInteractive is returned when the user has to enter the authorization
+// code but there is no terminal to enter it in, e.g. in CI pipelines or cron.
+var ErrNonInteractive = errors.New("unable to ask for the authorization code without a terminal")
+
+// ErrAuthDenied is returned when the user denies the application access.
+var ErrAuthDenied = errors.New("user denied access to the application")
+
+// ErrAuthTimeout is returned when the authorization code isn't received within
+// the timeout set with WithAuthTimeout.
+var ErrAuthTimeout = errors.New("timed out waiting for authorization")
+
+// ErrInterrupted is returned when the user interrupts the program with Ctrl-C
+// (or it is sent SIGTERM) while the authorization code is awaited, with
+// WithSignalHandling.
+var ErrInterrupted = errors.New("interrupted while waiting for authorization")
+
+// ErrCorruptCache is returned by the token stores of this package when the
+// stored token can't be decoded.
+var ErrCorruptCache = errors.New("cached token is corrupt")
+
+// ErrHostedDomainMismatch is returned when the user signed in with an account
+// that doesn't belong to the domain set with WithHostedDomain.
+var ErrHostedDomainMismatch = errors.New("user doesn't belong to the hosted domain")
+
+// ErrDryRun is returned instead of a token with WithDryRun.
+var ErrDryRun = errors.New("dry run, no token was requested")
+
+// ErrInvalidScope is returned when a requested scope is empty or is neither a
+// URL nor one of the short names openid, email and profile.
+var ErrInvalidScope = errors.New("invalid scope")
+
+// ErrCacheVersion is returned by the token stores of this package when the
+// stored token is in a format of a newer version of the package.
+var ErrCacheVersion = errors.New("cached token is in a newer format")
+
+// ErrNoRefreshToken is returned when a token has to be refreshed but there is
+// no refresh token, so the user has to authorize the application again.
+var ErrNoRefreshToken = errors.New("no refresh token, authorization is required")
+
+// ErrMissingScope is returned by VerifyTokenScopes when Google reports that
+// the token wasn't granted a required scope.
+var ErrMissingScope = errors.New("token lacks a required scope")
+
+// ErrInvalidProfile is returned when the name of a profile is empty or could
+// refer to a file outside the profile directory.
+var ErrInvalidProfile = errors.New("invalid profile name")
+
+// errWebServer is returned when the local web server for web application
+// credentials can't be started.
+var errWebServer = errors.New("unable to start the web server")
+
+// errNoStoredToken is returned by decodeToken when the persisted JSON has no
+// token, e.g. {} or null, so the token stores report it as corrupt rather than
+// return a nil token.
+var errNoStoredToken = errors.New("no token in the persisted JSON")
+
+// sentinelError is an error that matches a sentinel error with errors.Is while
+// keeping a descriptive message and its cause for errors.Is and errors.As.
+type sentinelError struct {
+	sentinel error
+	err      error
+}
+
+func (e *sentinelError) Error() string        { return e.err.Error() }
+func (e *sentinelError) Unwrap() error        { return e.err }
+func (e *sentinelError) Is(target error) bool { return target == e.sentinel }
+
+// withSentinel returns the error formatted like fmt.Errorf that also matches
+// sentinel.
+func withSentinel(sentinel error, format string, args ...interface{}) error {
+	return &sentinelError{sentinel: sentinel, err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,110 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/oauth2"
+)
+
+func TestWithSentinel(t *testing.T) {
+	_, cause := os.Open(filepath.Join(t.TempDir(), "missing"))
+	err := withSentinel(ErrNoCredentialFile, "unable to read credential file (missing). %w", cause)
+	if !errors.Is(err, ErrNoCredentialFile) {
+		t.Errorf("errors.Is(%v, ErrNoCredentialFile) = false", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("errors.Is(%v, os.ErrNotExist) = false", err)
+	}
+	var pe *os.PathError
+	if !errors.As(err, &pe) {
+		t.Errorf("errors.As(%v, *os.PathError) = false", err)
+	}
+	if errors.Is(err, ErrInvalidCredential) {
+		t.Errorf("errors.Is(%v, ErrInvalidCredential) = true", err)
+	}
+}
+
+func TestCredentialErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		credential string
+		data       string
+		want       error
+	}{
+		{name: "missing file", credential: "missing.json", want: ErrNoCredentialFile},
+		{name: "not JSON", data: "{", want: ErrInvalidCredential},
+		{name: "unknown type", data: `{"other":{}}`, want: ErrUnknownCredentialType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credential := filepath.Join(t.TempDir(), tt.credential)
+			if tt.data != "" {
+				credential = credentialFile(t, []byte(tt.data))
+			}
+			_, _, err := GetGoogleOauth2Token(context.Background(), credential, cachePath(t), []string{"email"}, WithPromptWriter(io.Discard))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetGoogleOauth2Token() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenExchangeErrorChain(t *testing.T) {
+	srv := newTokenServer(t)
+	srv.respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid_grant"}`)
+	}
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithBrowserOpener(redirectingBrowser(t, "code=c", nil)))
+	if !errors.Is(err, ErrTokenExchange) {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrTokenExchange)
+	}
+	var re *oauth2.RetrieveError
+	if !errors.As(err, &re) || re.Response.StatusCode != http.StatusBadRequest {
+		t.Errorf("errors.As(%v, *oauth2.RetrieveError) = false, want the response of the token endpoint", err)
+	}
+}
+
+func TestNoCodeError(t *testing.T) {
+	closed, w := io.Pipe()
+	w.Close()
+	for name, r := range map[string]io.Reader{
+		"empty":      strings.NewReader(""),
+		"closed":     closed,
+		"empty line": strings.NewReader("\n"),
+		"blank line": strings.NewReader(" \t\r\n"),
+	} {
+		o := newOptions(WithPromptWriter(io.Discard), WithCodeReader(r), WithBrowserOpener(func(string) error { return nil }))
+		if _, err := getCodeFromInstalled(context.Background(), "https://example.com/auth", "s", o); !errors.Is(err, ErrNoCode) {
+			t.Errorf("%v: getCodeFromInstalled() error = %v, want %v", name, err, ErrNoCode)
+		}
+	}
+}
+
+func TestCodeReadError(t *testing.T) {
+	readErr := errors.New("read failed")
+	o := newOptions(WithPromptWriter(io.Discard), WithCodeReader(iotest.ErrReader(readErr)))
+	_, err := getCodeFromInstalled(context.Background(), "https://example.com/auth", "s", o)
+	if !errors.Is(err, readErr) || errors.Is(err, ErrNoCode) {
+		t.Errorf("getCodeFromInstalled() error = %v, want the read error", err)
+	}
+}
+
+// The last line doesn't need a newline.
+func TestCodeAtEOF(t *testing.T) {
+	o := newOptions(WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c")))
+	if code, err := getCodeFromInstalled(context.Background(), "https://example.com/auth", "s", o); err != nil || code != "c" {
+		t.Errorf("getCodeFromInstalled() = %q, %v, want the code", code, err)
+	}
+}
@@ -28,8 +28,12 @@
 //
 // If it is a **web application** then gclientauth will attempt to run a local
 // webserver to get the code itself and create a token so the user don't have to
-// do anything themselves.  Make sure that the credential's redirect url port
-// matches what is passed to the package (e.g. localhost:8080).
+// do anything themselves.  The webserver listens on the port of the
+// credential's redirect url (e.g. localhost:8080) unless another one is passed
+// to the package.
+//
+// Behavior such as the port and whether to open a browser is changed by
+// passing Options (e.g. WithPort, WithBrowser) to GetGoogleOauth2Token.
 //
 //
 // Example Usage:
@@ -39,7 +43,7 @@
 //	   func main() {
 //		  scopes := []string{youtube.YoutubeReadonlyScope}
 //		  ctx := oauth2.NoContext
-//		  token, config, err := gclientauth.GetGoogleOauth2Token(ctx, "client_secret.json", "accesstoken.json", scopes, false, "8080")
+//		  token, config, err := gclientauth.GetGoogleOauth2Token(ctx, "client_secret.json", "accesstoken.json", scopes, gclientauth.WithPort("8080"))
 //		  ...
 //		  cfg := config.Client(ctx, token)
 //		  ...
@@ -56,163 +60,493 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"golang.org/x/term"
 )
 
 // openURL opens a browser window to the specified location.
 // This code originally appeared at:
 //   http://stackoverflow.com/questions/10377243/how-can-i-launch-a-process-that-is-not-a-file-in-go
 func openURL(url string) error {
-	var cmd *exec.Cmd
-	switch runtime.GOOS {
+	cmd, err := browserCommand(runtime.GOOS, runtime.GOOS == "linux" && isWSL(), exec.LookPath, url)
+	if err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+// browserCommand returns the command that opens the URL in a browser on the
+// operating system goos.  wsl is whether it is Linux running under the Windows
+// Subsystem for Linux, and lookPath finds the commands that may not be
+// installed, like exec.LookPath.
+func browserCommand(goos string, wsl bool, lookPath func(string) (string, error), url string) (*exec.Cmd, error) {
+	switch goos {
 	case "linux":
-		cmd = exec.Command("xdg-open", url)
+		if wsl {
+			return wslBrowserCommand(lookPath, url)
+		}
+		return exec.Command("xdg-open", url), nil
+	case "freebsd", "openbsd", "netbsd", "dragonfly", "illumos", "solaris":
+		return exec.Command("xdg-open", url), nil
 	case "windows":
-		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", "http://localhost:4001/")
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url), nil
 	case "darwin":
-		cmd = exec.Command("open", url)
+		return exec.Command("open", url), nil
 	default:
-		return fmt.Errorf("Cannot open URL %s on this platform", url)
+		return nil, fmt.Errorf("Cannot open URL %s on this platform", url)
 	}
-	return cmd.Run()
 }
 
-// getCodeFromInstalled asks the user to input the code from the auth URL.
-func getCodeFromInstalled(url string, browser bool) string {
-	var code string
-	var berr error
-	if browser {
-		berr = openURL(url)
+// isWSL returns whether the program is running under the Windows Subsystem for
+// Linux where xdg-open can't open the Windows browser.
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
 	}
+	version, err := os.ReadFile("/proc/version")
+	return err == nil && strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
 
-	if berr != nil || !browser {
-		fmt.Printf("Visit the URL for the auth dialog: \n\t%v\n", url)
+// wslBrowserCommand returns the command that opens the URL in the Windows
+// browser with wslview if it is installed or with cmd.exe otherwise.
+func wslBrowserCommand(lookPath func(string) (string, error), url string) (*exec.Cmd, error) {
+	if path, err := lookPath("wslview"); err == nil {
+		return exec.Command(path, url), nil
 	}
-	fmt.Print("Enter code: ")
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		code = scanner.Text()
-		break
+	if path, err := lookPath("cmd.exe"); err == nil {
+		// & separates commands in cmd.exe so it has to be escaped.
+		return exec.Command(path, "/c", "start", "", strings.ReplaceAll(url, "&", "^&")), nil
 	}
-	return code
+	return nil, fmt.Errorf("Cannot open URL %s on WSL, neither wslview nor cmd.exe found", url)
 }
 
-// getCodeFromWeb returns a code that is used to exchange for a token.
-func getCodeFromWeb(config *oauth2.Config, authURL, port string) string {
-	hostname, err := url.Parse(config.RedirectURL)
-	if err != nil {
-		fmt.Errorf("Unable to determine the hostname from %v. %v", config.RedirectURL, err)
-		return ""
+// isTerminal returns whether f is a terminal the user can type into.  Other
+// character devices, such as /dev/null, aren't terminals.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// getCodeFromInstalled asks the user to input the code from the auth URL,
+// reading it from stdin or the reader set with WithCodeReader.  It returns
+// ErrNonInteractive without asking in silent mode or if it would read from
+// stdin but stdin isn't a terminal.
+//
+// The user may also paste the whole URL they were redirected to, in which case
+// the code is taken from it after checking its state.  If the context is done
+// before the code is entered, the context's error is returned.
+func getCodeFromInstalled(ctx context.Context, url, state string, o *options) (string, error) {
+	if o.nonInteractive || o.silent {
+		return "", ErrNonInteractive
 	}
-	codeCh, err := startWebServer(hostname.Hostname(), port)
-	if err != nil {
-		log.Printf("Unable to start a web server. %v", err)
-		return ""
+	in := o.codeReader
+	if in == nil {
+		if !isTerminal(os.Stdin) {
+			return "", ErrNonInteractive
+		}
+		in = os.Stdin
 	}
 
-	err = openURL(authURL)
-	if err != nil {
-		fmt.Errorf("Unable to open authorization URL in web server: %v", err)
+	var berr error
+	opened := o.browser && !o.noBrowser
+	if opened {
+		berr = o.openBrowser(url)
+	}
+
+	if berr != nil || !opened {
+		o.showURL(url)
+	}
+	if o.requireState {
+		fmt.Fprint(o.promptWriter(), "Enter the URL you were redirected to: ")
 	} else {
-		fmt.Println("Your browser has been opened to an authorization URL.",
-			" This program will resume once authorization has been provided.\n")
-		fmt.Println(authURL)
+		fmt.Fprint(o.promptWriter(), "Enter code: ")
 	}
 
-	// Wait for the web server to get the code.
-	code := <-codeCh
-	return code
+	// Reading can't be interrupted so it is done in a goroutine that is
+	// abandoned if the context is done first.
+	codes := make(chan callbackResult, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		switch {
+		case scanner.Scan():
+			codes <- callbackResult{code: strings.TrimSpace(scanner.Text())}
+		case scanner.Err() != nil:
+			codes <- callbackResult{err: fmt.Errorf("unable to read the authorization code. %w", scanner.Err())}
+		default:
+			// The input was closed without a line.
+			codes <- callbackResult{err: ErrNoCode}
+		}
+	}()
+	select {
+	case r := <-codes:
+		if r.err != nil {
+			return "", r.err
+		}
+		return parseCode(r.code, state, o.requireState)
+	case <-ctx.Done():
+		fmt.Fprintln(o.promptWriter())
+		return "", ctx.Err()
+	}
+}
+
+// parseCode returns the code from the input of the user which is either the
+// code itself, the URL the browser was redirected to or its query.  The state
+// of the URL must match state.  If requireState is set, a code alone is
+// rejected with ErrStateMismatch because its state can't be verified.  An empty
+// input is ErrNoCode.
+func parseCode(input, state string, requireState bool) (string, error) {
+	if input == "" {
+		return "", withSentinel(ErrNoCode, "an empty authorization code was entered")
+	}
+	var q url.Values
+	if u, err := url.Parse(input); err == nil && u.Scheme != "" {
+		q = u.Query()
+	} else if strings.Contains(input, "=") {
+		q, _ = url.ParseQuery(strings.TrimPrefix(input, "?"))
+	}
+	if e := q.Get("error"); e != "" {
+		return "", authResponseError(e, q.Get("error_description"))
+	}
+	code := q.Get("code")
+	if code == "" {
+		if requireState {
+			return "", withSentinel(ErrStateMismatch, "unable to verify the state of a code alone, enter the URL the browser was redirected to")
+		}
+		return input, nil
+	}
+	if q.Get("state") != state {
+		return "", ErrStateMismatch
+	}
+	return code, nil
 }
 
-// startWebServer starts a web server that waits for an oauth code in the
-// three-legged auth flow.
-func startWebServer(hostname, port string) (codeCh chan string, err error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf("%v:%v", hostname, port))
+// getCodeFromWeb returns a code that is used to exchange for a token or an
+// error if the web server can't be started or the browser can't be opened.  It
+// stops waiting for the code and returns the context's error if ctx is done
+// first, or ErrAuthTimeout if the timeout set with WithAuthTimeout passes.
+//
+// The web server listens on the port of the redirect URL or, if it has none,
+// the port set with WithPort.  If port is empty or "0", it listens on a port
+// picked by the operating system and the config's RedirectURL is updated to
+// use it so the authorization URL for req redirects back to the server.  The
+// same is done for the port of the listener set with WithListener.  The scheme
+// is changed to https if WithTLS is used.
+func getCodeFromWeb(ctx context.Context, config *oauth2.Config, req *authRequest, o *options) (string, error) {
+	redirect, err := url.Parse(config.RedirectURL)
 	if err != nil {
-		log.Printf("Unable to do listener on %v. %v", hostname, err)
-		return nil, err
+		return "", fmt.Errorf("unable to parse the redirect URL %v. %w", config.RedirectURL, err)
+	}
+	var port string
+	if o.listener == nil {
+		port = o.callbackPort(redirect)
+	}
+	if o.redirectPath != "" {
+		redirect.Path = o.redirectPath
+	}
+	// Browsers ask for / when the redirect URL has no path.
+	path := redirect.Path
+	if path == "" {
+		path = "/"
+	}
+	if o.listener == nil {
+		o.checkListenHost(redirect.Hostname())
+	}
+	srv, err := startWebServer(o.listenHost(redirect.Hostname()), port, path, req.state, o)
+	if err != nil {
+		return "", withSentinel(errWebServer, "unable to start a web server. %w", err)
 	}
-	codeCh = make(chan string)
+	// The signals are handled as soon as the server is up so an interrupt
+	// while the browser is opened closes it too.
+	interrupt, stop := o.interrupts()
+	defer stop()
+	if port == "" || port == "0" || o.listener != nil {
+		_, p, err := net.SplitHostPort(srv.listener.Addr().String())
+		if err != nil {
+			srv.close()
+			return "", fmt.Errorf("unable to determine the port of %v. %w", srv.listener.Addr(), err)
+		}
+		redirect.Host = net.JoinHostPort(redirect.Hostname(), p)
+	}
+	if o.tls {
+		redirect.Scheme = "https"
+	}
+	config.RedirectURL = redirect.String()
+	authURL := req.url(config)
 
-	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		code := r.FormValue("code")
-		codeCh <- code // send code to OAuth flow
-		listener.Close()
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprintf(w, "Received code: %v\r\nYou can now safely close this browser window.", code)
-	}))
-	return codeCh, nil
-}
+	if o.noBrowser {
+		o.showURL(authURL)
+	} else if err := o.openBrowser(authURL); err != nil {
+		// The user can still open the URL themselves.
+		o.logger.Printf("Unable to open the authorization URL in a browser. %v", err)
+		o.showURL(authURL)
+	} else {
+		fmt.Fprintln(o.promptWriter(), "Your browser has been opened to an authorization URL.",
+			" This program will resume once authorization has been provided.")
+		fmt.Fprintln(o.promptWriter())
+		fmt.Fprintln(o.promptWriter(), o.link(authURL))
+	}
+	o.logger.Printf("Waiting for the authorization code on %v.", srv.listener.Addr())
+	if o.onListen != nil {
+		o.onListen(srv.listener.Addr().String())
+	}
 
-func GetGoogleOauth2Token(ctx context.Context, credential, cachedtoken string, scopes []string, browser bool, port string) (*oauth2.Token, *oauth2.Config, error) {
-	type cred struct {
+	var timeout <-chan time.Time
+	if o.authTimeout > 0 {
+		t := time.NewTimer(o.authTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	// Wait for the web server to get the code or for the caller to give up.
+	select {
+	case result := <-srv.results:
+		// Let the server finish sending the response to the browser.
+		if err := srv.shutdown(); err != nil && result.err == nil {
+			return "", fmt.Errorf("unable to shut down the web server. %w", err)
+		}
+		return result.code, result.err
+	case <-ctx.Done():
+		srv.close()
+		return "", ctx.Err()
+	case <-timeout:
+		srv.close()
+		return "", ErrAuthTimeout
+	case <-interrupt:
+		srv.close()
+		return "", ErrInterrupted
 	}
+}
 
-	var credtype struct {
-		Web       *cred `json:"web"`
-		Installed *cred `json:"installed"`
+// GetGoogleOauth2Token returns an access token and the oauth2 config for the
+// client credential file.  The token is read from the cachedtoken file (or the
+// TokenStore set with WithTokenStore) if it is still valid.  An expired token
+// is refreshed with its refresh token, and only if that isn't possible is the
+// user taken through the three-legged OAuth flow.  The new token is saved.  If
+// cachedtoken is empty the token is cached in the DefaultCachePath of the
+// application (see WithAppName), and if it is a directory in the
+// ScopedCacheFile of the client and scopes.  If credential is empty the file
+// named by $GOOGLE_APPLICATION_CREDENTIALS is used (see WithCredentialEnv).
+//
+// Of the redirect URIs of a web application credential, the first loopback URI
+// whose port is free is redirected to, so other URIs such as those of a
+// deployed application can be listed too.
+//
+// Authenticate returns the granted scopes and an HTTP client too.
+func GetGoogleOauth2Token(ctx context.Context, credential, cachedtoken string, scopes []string, opts ...Option) (*oauth2.Token, *oauth2.Config, error) {
+	r, err := Authenticate(ctx, credential, cachedtoken, scopes, opts...)
+	if err != nil {
+		return nil, nil, err
 	}
+	return r.Token, r.Config, nil
+}
 
-	data, err := ioutil.ReadFile(credential)
+// GetGoogleOauth2TokenFromJSON is like GetGoogleOauth2Token but takes the
+// contents of the client credential file, e.g. when it is embedded in the
+// application or fetched from a secret manager.
+func GetGoogleOauth2TokenFromJSON(ctx context.Context, data []byte, cachedtoken string, scopes []string, opts ...Option) (*oauth2.Token, *oauth2.Config, error) {
+	r, err := AuthenticateFromJSON(ctx, data, cachedtoken, scopes, opts...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to read client credential file (%v). %v", credential, err)
+		return nil, nil, err
 	}
+	return r.Token, r.Config, nil
+}
 
-	config, err := google.ConfigFromJSON(data, scopes...)
+// Authenticate returns the token for the client credential file, getting it
+// like GetGoogleOauth2Token, along with the config and granted scopes.
+func Authenticate(ctx context.Context, credential, cachedtoken string, scopes []string, opts ...Option) (*Result, error) {
+	data, err := readCredential(credential, newOptions(opts...).credentialEnv, "client credential")
 	if err != nil {
-		return nil, nil, fmt.Errorf("error parsing credential file. %v", err)
+		return nil, err
 	}
+	return AuthenticateFromJSON(ctx, data, cachedtoken, scopes, opts...)
+}
 
-	var token *oauth2.Token
+// AuthenticateFromJSON is like Authenticate but takes the contents of the
+// client credential file.
+func AuthenticateFromJSON(ctx context.Context, data []byte, cachedtoken string, scopes []string, opts ...Option) (*Result, error) {
+	o := newOptions(opts...)
+	ctx = o.context(ctx)
 
-	// Try to read the token from the cache file.
-	// If an error occurs, do the three-legged OAuth flow because
-	// the token is invalid or doesn't exist.
-	t, err := ioutil.ReadFile(cachedtoken)
-	if err == nil {
-		err = json.Unmarshal(t, &token)
+	config, installed, err := parseCredential(data, scopes)
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		o.useLoopbackRedirect(config, redirectURIs(data))
+	}
+	if o.endpoint != nil {
+		config.Endpoint = *o.endpoint
 	}
 
-	if (err != nil) || !token.Valid() {
+	store, err := o.tokenStore(cachedtoken, config)
+	if err != nil {
+		return nil, err
+	}
+	if o.dryRun {
+		return nil, dryRun(config, installed, store, o)
+	}
+	token, err := cachedToken(ctx, config, store, o, authorizer(ctx, config, installed, o))
+	if err != nil {
+		return nil, err
+	}
+	return newResult(token, config, store, o), nil
+}
 
+// authorizer returns the function that takes the user through the
+// three-legged OAuth flow for the config of a desktop/other (installed) or web
+// application credential.
+func authorizer(ctx context.Context, config *oauth2.Config, installed bool, o *options) func() (*oauth2.Token, error) {
+	return func() (*oauth2.Token, error) {
 		var code string
 		// Redirect user to Google's consent page to ask for permission
-		// for the scopes specified above.
-		url := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-
-		if err := json.Unmarshal(data, &credtype); err != nil {
-			return nil, nil, fmt.Errorf("error parsing credential file. %v", err)
+		// for the config's scopes.
+		req, err := newAuthRequest(o, installed)
+		if err != nil {
+			return nil, err
 		}
-		switch {
-		case credtype.Installed != nil:
-			code = getCodeFromInstalled(url, browser)
-		case credtype.Web != nil:
-			code = getCodeFromWeb(config, url, port)
+		if installed {
+			code, err = getCodeFromInstalled(ctx, req.url(config), req.state, o)
+		} else {
+			code, err = getCodeFromWeb(ctx, config, req, o)
+			if errors.Is(err, errWebServer) && !o.noManualFallback {
+				o.logger.Printf("(WARNING) %v. Falling back to entering the code manually.", err)
+				fmt.Fprintln(o.promptWriter(), "Once you have authorized the application, enter the URL your browser is redirected to, even if the page doesn't load.")
+				code, err = getCodeFromInstalled(ctx, req.url(config), req.state, o)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the authorization code. %w", err)
+		}
+		if code == "" {
+			return nil, ErrNoCode
 		}
 		// Exchanging for a token invalidates previous code so the same
 		// code can't be used again.
-		token, err = config.Exchange(ctx, code)
+		token, _, err := req.exchange(ctx, config, code)
 		if err != nil {
-			return nil, nil, fmt.Errorf("unable to get valid token. code = \"%v\"\n%v", code, err)
+			return nil, withSentinel(ErrTokenExchange, "unable to get valid token. code = \"%v\"\n%w", redact(code), err)
 		}
-		data, err := json.Marshal(token)
-		if err != nil {
-			return nil, nil, fmt.Errorf("unable to encode the token for writing to cache. %v", err)
+		return token, nil
+	}
+}
+
+// dryRun logs how the token would be got and returns ErrDryRun.
+func dryRun(config *oauth2.Config, installed bool, store TokenStore, o *options) error {
+	req, err := newAuthRequest(o, installed)
+	if err != nil {
+		return err
+	}
+	flow := "web application (local web server)"
+	if installed {
+		flow = "desktop/other (code entered by the user)"
+	}
+	cache := storePath(store)
+	if cache == "" {
+		cache = fmt.Sprintf("%T", store)
+	}
+	o.logger.Printf("Dry run: flow %v, scopes %v, redirect URL %v, token cache %v.", flow, config.Scopes, config.RedirectURL, cache)
+	o.logger.Printf("Dry run: authorization URL %v", req.url(config))
+	return ErrDryRun
+}
+
+// credentialKeys returns the sorted top-level keys of the credential JSON.
+func credentialKeys(data []byte) []string {
+	var m map[string]json.RawMessage
+	json.Unmarshal(data, &m)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cachedToken returns the token in store if it is still valid, refreshing it
+// with its refresh token if it has expired.  If there is no usable token, or
+// the token is known to lack some of the config's scopes or to be for another
+// client, the token from authorize is returned instead.  The token is saved if
+// it changed.  The store is locked meanwhile so concurrent calls don't both
+// authorize.
+func cachedToken(ctx context.Context, config *oauth2.Config, store TokenStore, o *options, authorize func() (*oauth2.Token, error)) (*oauth2.Token, error) {
+	unlock, err := o.lockStore(store)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Try to load the token from the store.
+	// If an error occurs, authorize again because the token is invalid
+	// or doesn't exist.
+	token, err := store.Load(ctx)
+	switch {
+	case errors.Is(err, ErrCorruptCache):
+		o.logger.Printf("(WARNING) Cached token is corrupt and will be replaced after authorization. %v", err)
+	case errors.Is(err, ErrCacheVersion):
+		o.logger.Printf("(WARNING) Cached token was saved by a newer version and will be replaced after authorization. %v", err)
+	case err != nil:
+		o.logger.Printf("No cached token, authorization is required. %v", err)
+	}
+	if h := tokenClientHash(token); err == nil && h != "" && h != clientHash(config.ClientID) {
+		// The token can't be used or refreshed with the client the
+		// credential is for now.
+		o.logger.Printf("Cached token is for another client, authorization is required.")
+		token = nil
+	}
+	changed := false
+	if err == nil && !o.valid(token) && token != nil && token.RefreshToken != "" {
+		// The access token has expired but it can be refreshed without
+		// asking the user to authorize the application again.
+		if t, rerr := refreshToken(ctx, config, token); rerr == nil {
+			o.logger.Printf("Refreshed the expired cached token. %v", RedactedToken(t))
+			token, changed = inheritGrant(t, token), true
+		} else {
+			o.logger.Printf("Unable to refresh the expired cached token, authorization is required. %v", rerr)
+		}
+	}
+	if err == nil && o.valid(token) {
+		// A token whose granted scopes are known but lack some of the
+		// requested scopes would fail when calling the APIs.
+		if granted := GrantedScopes(token); granted != nil {
+			if missing := missingScopes(config.Scopes, granted); len(missing) > 0 {
+				o.logger.Printf("Cached token lacks the scopes %v, authorization is required.", missing)
+				token = nil
+			}
 		}
-		if err := ioutil.WriteFile(cachedtoken, data, 0644); err != nil {
-			fmt.Errorf("(WARNING) Unable to write token to local cache.\n")
+	}
+	if (err != nil) || !o.valid(token) {
+		if token, err = authorize(); err != nil {
+			return nil, err
+		}
+		token, changed = withExtra(token, grantedAtKey, o.now()), true
+	}
+	if changed {
+		if tokenClientHash(token) == "" {
+			token = withExtra(token, clientHashKey, clientHash(config.ClientID))
 		}
+		if err := store.Save(ctx, token); err != nil {
+			o.logger.Printf("(WARNING) Unable to write token to local cache. %v", err)
+		}
+	}
+	return token, nil
+}
+
+// GetGoogleClient returns an HTTP client that authorizes its requests with the
+// token source from GetTokenSource so it can be passed directly to the Google
+// API client libraries.  Tokens refreshed by the client are saved.
+func GetGoogleClient(ctx context.Context, credential, cachedtoken string, scopes []string, opts ...Option) (*http.Client, error) {
+	r, err := Authenticate(ctx, credential, cachedtoken, scopes, opts...)
+	if err != nil {
+		return nil, err
 	}
-	return token, config, nil
+	return r.Client(ctx), nil
 }
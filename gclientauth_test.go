@@ -0,0 +1,860 @@
+package gclientauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestWebFlowContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	addrs := make(chan string, 1)
+	_, _, err := GetGoogleOauth2TokenFromJSON(ctx, webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithPromptWriter(io.Discard),
+		WithBrowserOpener(func(string) error { return nil }),
+		WithListenerCallback(func(addr string) { addrs <- addr }))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if c, err := net.Dial("tcp", <-addrs); err == nil {
+		c.Close()
+		t.Error("the web server still accepts connections after the context is done")
+	}
+}
+
+func TestWebFlowFreePort(t *testing.T) {
+	srv := newTokenServer(t)
+	redirects := make(chan string, 1)
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithBrowserOpener(redirectingBrowser(t, "code=c", redirects)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want %q", token.AccessToken, "at")
+	}
+	u, err := url.Parse(<-redirects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := u.Port(); p == "" || p == "0" {
+		t.Errorf("redirect URI %v doesn't have the port picked by the operating system", u)
+	}
+	if got := srv.lastForm().Get("redirect_uri"); got != u.String() {
+		t.Errorf("exchange redirect_uri = %q, want %q", got, u)
+	}
+}
+
+func TestGetCodeFromWebErrors(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	tests := []struct {
+		name       string
+		redirect   string
+		opts       []Option
+		wantServer bool
+	}{
+		{name: "invalid redirect URL", redirect: "http://localhost:%zz/"},
+		{name: "port in use", redirect: "http://" + busy.Addr().String() + "/", wantServer: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions(WithPromptWriter(io.Discard), WithBrowserOpener(func(string) error { return nil }))
+			req, err := newAuthRequest(o, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := getCodeFromWeb(context.Background(), &oauth2.Config{RedirectURL: tt.redirect}, req, o)
+			if err == nil || code != "" {
+				t.Fatalf("getCodeFromWeb() = %q, %v, want an error", code, err)
+			}
+			if got := errors.Is(err, errWebServer); got != tt.wantServer {
+				t.Errorf("getCodeFromWeb() error = %v, is errWebServer = %v, want %v", err, got, tt.wantServer)
+			}
+		})
+	}
+}
+
+func TestWebFlowErrorIsWrapped(t *testing.T) {
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost:%zz/"), cachePath(t), []string{"email"},
+		WithPromptWriter(io.Discard), WithManualFallback(false))
+	if err == nil || !strings.Contains(err.Error(), "unable to parse the redirect URL") {
+		t.Errorf("GetGoogleOauth2TokenFromJSON() error = %v, want the redirect URL error", err)
+	}
+}
+
+// noLookPath is a lookPath that finds no commands.
+func noLookPath(file string) (string, error) {
+	return "", exec.ErrNotFound
+}
+
+func TestBrowserCommand(t *testing.T) {
+	const authURL = "https://accounts.example.com/auth?client_id=c&state=s"
+	tests := []struct {
+		goos string
+		want []string
+	}{
+		{goos: "linux", want: []string{"xdg-open", authURL}},
+		{goos: "windows", want: []string{"rundll32", "url.dll,FileProtocolHandler", authURL}},
+		{goos: "darwin", want: []string{"open", authURL}},
+		{goos: "freebsd", want: []string{"xdg-open", authURL}},
+		{goos: "openbsd", want: []string{"xdg-open", authURL}},
+		{goos: "netbsd", want: []string{"xdg-open", authURL}},
+		{goos: "dragonfly", want: []string{"xdg-open", authURL}},
+		{goos: "illumos", want: []string{"xdg-open", authURL}},
+		{goos: "solaris", want: []string{"xdg-open", authURL}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goos, func(t *testing.T) {
+			cmd, err := browserCommand(tt.goos, false, noLookPath, authURL)
+			if err != nil {
+				t.Fatalf("browserCommand() error = %v", err)
+			}
+			if !reflect.DeepEqual(cmd.Args, tt.want) {
+				t.Errorf("browserCommand() args = %q, want %q", cmd.Args, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrowserCommandUnsupported(t *testing.T) {
+	if cmd, err := browserCommand("plan9", false, noLookPath, "https://example.com"); err == nil {
+		t.Errorf("browserCommand(plan9) = %q, want an error", cmd.Args)
+	}
+}
+
+// The URL is shown if the browser can't be opened, e.g. on an unsupported
+// platform.
+func TestBrowserFailureShowsURL(t *testing.T) {
+	const authURL = "https://accounts.example.com/auth?state=s"
+	var out strings.Builder
+	o := newOptions(WithBrowser(true), WithPromptWriter(&out), WithCodeReader(strings.NewReader("c\n")),
+		WithBrowserOpener(func(url string) error { return fmt.Errorf("Cannot open URL %s on this platform", url) }))
+	code, err := getCodeFromInstalled(context.Background(), authURL, "s", o)
+	if err != nil || code != "c" {
+		t.Fatalf("getCodeFromInstalled() = %q, %v, want the code", code, err)
+	}
+	if !strings.Contains(out.String(), "Visit the URL for the auth dialog: \n\t"+authURL+"\n") {
+		t.Errorf("prompt = %q, want the URL", out.String())
+	}
+}
+
+func TestExpiredCachedTokenIsRefreshed(t *testing.T) {
+	srv := newTokenServer(t)
+	path := cachePath(t)
+	expired := withScopes(&oauth2.Token{AccessToken: "expired", RefreshToken: "rt", Expiry: time.Now().Add(-time.Hour)}, []string{"email"})
+	if err := (FileTokenStore{Path: path}).Save(context.Background(), expired); err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), path, []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithBrowserOpener(func(string) error { return errors.New("the browser must not be opened") }))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want the refreshed token", token.AccessToken)
+	}
+	if token.RefreshToken != "rt" {
+		t.Errorf("RefreshToken = %q, want it kept", token.RefreshToken)
+	}
+	if saved, err := (FileTokenStore{Path: path}).Load(context.Background()); err != nil || saved.AccessToken != "at" {
+		t.Errorf("cached token = %v, %v, want the refreshed token", saved, err)
+	}
+}
+
+func TestFailedRefreshFallsBackToAuthorization(t *testing.T) {
+	srv := newTokenServer(t)
+	srv.respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("grant_type") == "refresh_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		io.WriteString(w, tokenResponse)
+	}
+	path := cachePath(t)
+	expired := withScopes(&oauth2.Token{AccessToken: "expired", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour)}, []string{"email"})
+	if err := (FileTokenStore{Path: path}).Save(context.Background(), expired); err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), path, []string{"email"},
+		WithPort("0"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithBrowserOpener(redirectingBrowser(t, "code=c", nil)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if token.AccessToken != "at" || srv.requests("authorization_code") != 1 {
+		t.Errorf("AccessToken = %q after %d exchanges, want the token of the authorization", token.AccessToken, srv.requests("authorization_code"))
+	}
+}
+
+// lookPathOf returns a lookPath that only finds the commands, in /usr/bin.
+func lookPathOf(commands ...string) func(string) (string, error) {
+	return func(file string) (string, error) {
+		for _, c := range commands {
+			if c == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+}
+
+func TestBrowserCommandWSL(t *testing.T) {
+	const authURL = "https://accounts.example.com/auth?client_id=c&state=s"
+	tests := []struct {
+		name     string
+		commands []string
+		want     []string
+	}{
+		{name: "wslview", commands: []string{"wslview", "cmd.exe", "xdg-open"}, want: []string{"/usr/bin/wslview", authURL}},
+		{name: "cmd.exe", commands: []string{"cmd.exe", "xdg-open"}, want: []string{"/usr/bin/cmd.exe", "/c", "start", "", "https://accounts.example.com/auth?client_id=c^&state=s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := browserCommand("linux", true, lookPathOf(tt.commands...), authURL)
+			if err != nil {
+				t.Fatalf("browserCommand() error = %v", err)
+			}
+			if !reflect.DeepEqual(cmd.Args, tt.want) {
+				t.Errorf("browserCommand() args = %q, want %q", cmd.Args, tt.want)
+			}
+		})
+	}
+
+	if cmd, err := browserCommand("linux", true, lookPathOf("xdg-open"), authURL); err == nil {
+		t.Errorf("browserCommand() without wslview or cmd.exe = %q, want an error", cmd.Args)
+	}
+}
+
+func TestIsWSLFromEnv(t *testing.T) {
+	setenv(t, "WSL_DISTRO_NAME", "Ubuntu")
+	if !isWSL() {
+		t.Error("isWSL() = false with WSL_DISTRO_NAME set")
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	if isTerminal(devNull) {
+		t.Errorf("isTerminal(%v) = true", os.DevNull)
+	}
+	f, err := os.Create(cachePath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Error("isTerminal(regular file) = true")
+	}
+}
+
+func TestGetCodeFromInstalledNonInteractive(t *testing.T) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdin := os.Stdin
+	os.Stdin = devNull
+	defer func() { os.Stdin = stdin }()
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "stdin is /dev/null"},
+		{name: "WithNonInteractive", opts: []Option{WithNonInteractive(true), WithCodeReader(strings.NewReader("code\n"))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions(append([]Option{WithPromptWriter(io.Discard)}, tt.opts...)...)
+			if code, err := getCodeFromInstalled(context.Background(), "https://example.com/auth", "s", o); !errors.Is(err, ErrNonInteractive) {
+				t.Errorf("getCodeFromInstalled() = %q, %v, want %v", code, err, ErrNonInteractive)
+			}
+		})
+	}
+}
+
+func TestLoggerAndPromptWriter(t *testing.T) {
+	srv := newTokenServer(t)
+	logger := &recordingLogger{}
+	var prompt strings.Builder
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithEndpoint(srv.endpoint()), WithLogger(logger), WithPromptWriter(&prompt),
+		WithBrowserOpener(redirectingBrowser(t, "code=c", nil)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if !logger.contains("Waiting for the authorization code on 127.0.0.1:") {
+		t.Errorf("logged %q, want the address of the web server", logger.lines)
+	}
+	if !strings.Contains(prompt.String(), srv.URL+"/auth?") {
+		t.Errorf("prompt = %q, want the authorization URL", prompt.String())
+	}
+}
+
+// captureStdout returns what f writes to os.Stdout.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestSilentWritesNothing(t *testing.T) {
+	srv := newTokenServer(t)
+	var installedErr, webErr error
+	out := captureStdout(t, func() {
+		_, _, installedErr = GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), cachePath(t), []string{"email"},
+			WithEndpoint(srv.endpoint()), WithSilent(true), WithCodeReader(strings.NewReader("c\n")))
+		_, _, webErr = GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+			WithPort("0"), WithEndpoint(srv.endpoint()), WithSilent(true),
+			WithBrowserOpener(redirectingBrowser(t, "code=c", nil)))
+	})
+	if !errors.Is(installedErr, ErrNonInteractive) {
+		t.Errorf("installed flow error = %v, want %v", installedErr, ErrNonInteractive)
+	}
+	if webErr != nil {
+		t.Errorf("web flow error = %v", webErr)
+	}
+	if out != "" {
+		t.Errorf("wrote %q to stdout in silent mode", out)
+	}
+}
+
+func TestInstalledFlowCodeReader(t *testing.T) {
+	srv := newTokenServer(t)
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), cachePath(t), []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("  the-code \t\nignored\n")))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want %q", token.AccessToken, "at")
+	}
+	if code := srv.lastForm().Get("code"); code != "the-code" {
+		t.Errorf("exchanged code = %q, want the trimmed first line", code)
+	}
+}
+
+func TestGetCodeFromInstalledContextDone(t *testing.T) {
+	// Nothing is ever written to the reader, like a user who doesn't answer.
+	r, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	o := newOptions(WithPromptWriter(io.Discard), WithCodeReader(r))
+	errc := make(chan error, 1)
+	go func() {
+		_, err := getCodeFromInstalled(ctx, "https://example.com/auth", "s", o)
+		errc <- err
+	}()
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("getCodeFromInstalled() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("getCodeFromInstalled() didn't return when the context was canceled")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := GetGoogleOauth2TokenFromJSON(ctx, installedCredential("client"), cachePath(t), []string{"email"},
+		WithPromptWriter(io.Discard), WithCodeReader(r)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		requireState bool
+		want         string
+		wantErr      error
+	}{
+		{name: "code", input: "4/abc", want: "4/abc"},
+		{name: "URL", input: "http://localhost/cb?state=s&code=4%2Fabc&scope=email", want: "4/abc"},
+		{name: "query", input: "?state=s&code=c", want: "c"},
+		{name: "URL with another state", input: "http://localhost/cb?state=other&code=c", wantErr: ErrStateMismatch},
+		{name: "URL without state", input: "http://localhost/cb?code=c", wantErr: ErrStateMismatch},
+		{name: "denied", input: "http://localhost/cb?state=s&error=access_denied", wantErr: ErrAuthDenied},
+		{name: "code with required state", input: "c", requireState: true, wantErr: ErrStateMismatch},
+		{name: "URL with required state", input: "http://localhost/cb?state=s&code=c", requireState: true, want: "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCode(tt.input, "s", tt.requireState)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("parseCode(%q) = %q, %v, want %v", tt.input, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseCode(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFullFlowWithEndpoint(t *testing.T) {
+	srv := newTokenServer(t)
+	path := cachePath(t)
+	var authURL string
+	redirect := redirectingBrowser(t, "code=the-code", nil)
+	opts := []Option{WithPort("0"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithBrowserOpener(func(u string) error {
+			authURL = u
+			return redirect(u)
+		})}
+
+	token, config, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), path, []string{"email"}, opts...)
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if !strings.HasPrefix(authURL, srv.URL+"/auth?") {
+		t.Errorf("authorization URL = %q, want the one of the endpoint", authURL)
+	}
+	if config.Endpoint != srv.endpoint() {
+		t.Errorf("config.Endpoint = %+v, want %+v", config.Endpoint, srv.endpoint())
+	}
+	f := srv.lastForm()
+	if f.Get("grant_type") != "authorization_code" || f.Get("code") != "the-code" || f.Get("client_id") != "web-client" || f.Get("redirect_uri") != config.RedirectURL {
+		t.Errorf("exchange form = %v", f)
+	}
+	if token.AccessToken != "at" || token.RefreshToken != "rt" || !reflect.DeepEqual(GrantedScopes(token), []string{"email"}) {
+		t.Errorf("token = %+v, want the token of the endpoint", token)
+	}
+
+	// The second call uses the cached token.
+	again, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), path, []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithBrowserOpener(func(string) error { return errors.New("the browser must not be opened") }))
+	if err != nil {
+		t.Fatalf("second GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if again.AccessToken != "at" || srv.requests("authorization_code") != 1 {
+		t.Errorf("second call = %q after %d exchanges, want the cached token", again.AccessToken, srv.requests("authorization_code"))
+	}
+}
+
+func TestGetCodeFromInstalledState(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		requireState bool
+		want         string
+		wantErr      error
+	}{
+		{name: "matching state", input: "http://localhost/?state=s&code=c\n", want: "c"},
+		{name: "mismatched state", input: "http://localhost/?state=other&code=c\n", wantErr: ErrStateMismatch},
+		{name: "bare code", input: "c\n", want: "c"},
+		{name: "bare code with required state", input: "c\n", requireState: true, wantErr: ErrStateMismatch},
+		{name: "matching state required", input: "http://localhost/?state=s&code=c\n", requireState: true, want: "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions(WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader(tt.input)), WithRequireState(tt.requireState))
+			code, err := getCodeFromInstalled(context.Background(), "https://example.com/auth", "s", o)
+			if code != tt.want || !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("getCodeFromInstalled() = %q, %v, want %q, %v", code, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A pasted URL of another authorization request isn't exchanged.
+func TestInstalledFlowStateMismatch(t *testing.T) {
+	srv := newTokenServer(t)
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), cachePath(t), []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("http://localhost/?state=forged&code=c\n")))
+	if !errors.Is(err, ErrStateMismatch) {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrStateMismatch)
+	}
+	if n := srv.requests("authorization_code"); n != 0 {
+		t.Errorf("%d code exchanges, want none", n)
+	}
+}
+
+// syncBuffer is a strings.Builder that can be written and read concurrently.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+// shownURL returns the authorization URL written by showURL.  It may be
+// called by other goroutines than the test's so it doesn't stop the test.
+func shownURL(t *testing.T, prompt string) string {
+	const prefix = "Visit the URL for the auth dialog: \n\t"
+	i := strings.Index(prompt, prefix)
+	if i < 0 {
+		t.Errorf("prompt = %q, want the authorization URL", prompt)
+		return ""
+	}
+	u := prompt[i+len(prefix):]
+	return u[:strings.Index(u, "\n")]
+}
+
+func TestNoBrowser(t *testing.T) {
+	opened := 0
+	neverOpen := WithBrowserOpener(func(string) error {
+		opened++
+		return nil
+	})
+
+	t.Run("installed", func(t *testing.T) {
+		srv := newTokenServer(t)
+		var out syncBuffer
+		_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), cachePath(t), []string{"email"},
+			WithBrowser(true), WithNoBrowser(true), neverOpen, WithEndpoint(srv.endpoint()), WithPromptWriter(&out), WithCodeReader(strings.NewReader("c\n")))
+		if err != nil {
+			t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+		}
+		shownURL(t, out.String())
+	})
+
+	t.Run("web", func(t *testing.T) {
+		srv := newTokenServer(t)
+		var out syncBuffer
+		// The URL is printed before the server waits for the redirect.
+		redirect := func(string) {
+			redirectingBrowser(t, "code=c", nil)(shownURL(t, out.String()))
+		}
+		_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+			WithPort("0"), WithNoBrowser(true), neverOpen, WithEndpoint(srv.endpoint()), WithPromptWriter(&out), WithListenerCallback(redirect))
+		if err != nil {
+			t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+		}
+	})
+
+	if opened != 0 {
+		t.Errorf("the browser was opened %d times, want never", opened)
+	}
+}
+
+// lazyReader reads the string returned by the function when it is first read,
+// e.g. to answer a prompt with what it showed.
+type lazyReader struct {
+	text func() string
+	r    io.Reader
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil {
+		l.r = strings.NewReader(l.text())
+	}
+	return l.r.Read(p)
+}
+
+func TestWebServerBindFailureFallback(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	redirect := "http://localhost:" + strconv.Itoa(busy.Addr().(*net.TCPAddr).Port) + "/cb"
+
+	t.Run("fallback", func(t *testing.T) {
+		srv := newTokenServer(t)
+		var out syncBuffer
+		logger := &recordingLogger{}
+		// The user pastes the URL the browser was redirected to.
+		pasted := &lazyReader{text: func() string {
+			u, err := url.Parse(shownURL(t, out.String()))
+			if err != nil {
+				t.Error(err)
+				return ""
+			}
+			return redirect + "?state=" + url.QueryEscape(u.Query().Get("state")) + "&code=c\n"
+		}}
+		token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential(redirect), cachePath(t), []string{"email"},
+			WithEndpoint(srv.endpoint()), WithPromptWriter(&out), WithLogger(logger), WithCodeReader(pasted))
+		if err != nil {
+			t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+		}
+		if token.AccessToken != "at" {
+			t.Errorf("AccessToken = %q, want the token of the pasted code", token.AccessToken)
+		}
+		if !logger.contains("(WARNING) unable to start a web server") || !logger.contains("Falling back to entering the code manually.") {
+			t.Errorf("logged %q, want a warning about the fallback", logger.lines)
+		}
+		if !strings.Contains(out.String(), "enter the URL your browser is redirected to") {
+			t.Errorf("prompt = %q, want the manual prompt", out.String())
+		}
+		if got := srv.lastForm().Get("redirect_uri"); got != redirect {
+			t.Errorf("exchange redirect_uri = %q, want %q", got, redirect)
+		}
+	})
+
+	t.Run("WithManualFallback(false)", func(t *testing.T) {
+		srv := newTokenServer(t)
+		_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential(redirect), cachePath(t), []string{"email"},
+			WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithManualFallback(false), WithCodeReader(strings.NewReader("c\n")))
+		if err == nil || !strings.Contains(err.Error(), "unable to start a web server") {
+			t.Errorf("GetGoogleOauth2TokenFromJSON() error = %v, want the web server error", err)
+		}
+		if n := srv.requests("authorization_code"); n != 0 {
+			t.Errorf("%d code exchanges, want none", n)
+		}
+	})
+}
+
+// failingTransport is an http.RoundTripper that fails every request and counts
+// them.
+type failingTransport struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (f *failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	return nil, errors.New("no network in a dry run")
+}
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		credential []byte
+		flow       string
+	}{
+		{name: "installed", credential: installedCredential("client"), flow: "flow desktop/other"},
+		{name: "web", credential: webCredential("http://localhost/cb"), flow: "flow web application"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := cachePath(t)
+			transport := &failingTransport{}
+			logger := &recordingLogger{}
+			var prompt strings.Builder
+			_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), tt.credential, path, []string{"email"},
+				WithDryRun(true), WithTransport(transport), WithLogger(logger), WithPromptWriter(&prompt), WithBrowser(true),
+				WithBrowserOpener(func(string) error { return errors.New("the browser must not be opened") }),
+				WithCodeReader(iotest.ErrReader(errors.New("the user must not be asked"))))
+			if !errors.Is(err, ErrDryRun) {
+				t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrDryRun)
+			}
+			if transport.requests != 0 {
+				t.Errorf("%d requests were sent, want none", transport.requests)
+			}
+			if prompt.Len() != 0 {
+				t.Errorf("prompt = %q, want none", prompt.String())
+			}
+			for _, want := range []string{tt.flow, "scopes [email]", "token cache " + path, "authorization URL https://accounts.example.com/auth?"} {
+				if !logger.contains(want) {
+					t.Errorf("logged %q, want %q", logger.lines, want)
+				}
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("the token cache was written in a dry run: %v", err)
+			}
+		})
+	}
+}
+
+// A dry run doesn't listen on the ports of the redirect URIs to pick one.
+func TestDryRunDoesNotListen(t *testing.T) {
+	busy, free := "http://localhost:"+busyPort(t)+"/cb", "http://localhost:"+freePort(t)+"/cb"
+	logger := &recordingLogger{}
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("https://app.example.com/cb", busy, free), cachePath(t), []string{"email"},
+		WithDryRun(true), WithLogger(logger), WithTransport(&failingTransport{}))
+	if !errors.Is(err, ErrDryRun) {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrDryRun)
+	}
+	// Trying the ports would have found the busy one and picked the free one.
+	if !logger.contains("redirect URL " + busy + ",") {
+		t.Errorf("logged %q, want the first loopback URI %v without trying its port", logger.lines, busy)
+	}
+}
+
+// A dry run reports the default token cache without creating its directory.
+func TestDryRunDoesNotCreateCacheDir(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skipf("$XDG_CONFIG_HOME isn't used on %v", runtime.GOOS)
+	}
+	base := t.TempDir()
+	setenv(t, "XDG_CONFIG_HOME", base)
+	for _, opts := range [][]Option{nil, {WithProfile("work")}} {
+		logger := &recordingLogger{}
+		_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), "", []string{"email"},
+			append(opts, WithDryRun(true), WithAppName("app"), WithLogger(logger), WithTransport(&failingTransport{}))...)
+		if !errors.Is(err, ErrDryRun) {
+			t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrDryRun)
+		}
+		if !logger.contains("token cache " + filepath.Join(base, "app")) {
+			t.Errorf("logged %q, want the default token cache in %v", logger.lines, base)
+		}
+	}
+	if entries, err := os.ReadDir(base); err != nil || len(entries) != 0 {
+		t.Errorf("configuration directory = %v, %v, want nothing created in a dry run", entries, err)
+	}
+}
+
+// An expired cached token isn't refreshed in a dry run.
+func TestDryRunDoesNotRefresh(t *testing.T) {
+	srv := newTokenServer(t)
+	store := &MemoryTokenStore{}
+	store.Save(context.Background(), withScopes(&oauth2.Token{AccessToken: "expired", RefreshToken: "rt", Expiry: time.Now().Add(-time.Hour)}, []string{"email"}))
+	if _, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), "", []string{"email"},
+		WithDryRun(true), WithTokenStore(store), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard)); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrDryRun)
+	}
+	if n := len(srv.forms); n != 0 {
+		t.Errorf("%d requests to the token endpoint, want none", n)
+	}
+}
+
+// A cached token of another client can't be used or refreshed with the
+// client of the credential, so the user authorizes the application again.
+func TestChangedClientIsReauthorized(t *testing.T) {
+	srv := newTokenServer(t)
+	path := cachePath(t)
+	get := func(clientID string, logger Logger) *oauth2.Token {
+		token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential(clientID), path, []string{"email"},
+			WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")), WithLogger(logger))
+		if err != nil {
+			t.Fatalf("GetGoogleOauth2TokenFromJSON(%v) error = %v", clientID, err)
+		}
+		return token
+	}
+
+	get("client-a", nopLogger{})
+	saved, err := (FileTokenStore{Path: path}).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tokenClientHash(saved), clientHash("client-a"); got != want {
+		t.Errorf("cached client hash = %q, want %q", got, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("client-a")) {
+		t.Errorf("token file = %s, want the client ID hashed", data)
+	}
+
+	get("client-a", nopLogger{})
+	if n := srv.requests("authorization_code"); n != 1 {
+		t.Errorf("%d exchanges with the same client, want the cached token used", n)
+	}
+
+	logger := &recordingLogger{}
+	get("client-b", logger)
+	if n := srv.requests("authorization_code"); n != 2 {
+		t.Errorf("%d exchanges after the client changed, want it authorized again", n)
+	}
+	if !logger.contains("Cached token is for another client") {
+		t.Errorf("logged %q, want the reason for authorizing again", logger.lines)
+	}
+	if n := srv.requests("refresh_token"); n != 0 {
+		t.Errorf("%d refreshes, want the token of the other client not refreshed", n)
+	}
+	saved, err = (FileTokenStore{Path: path}).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tokenClientHash(saved), clientHash("client-b"); got != want {
+		t.Errorf("cached client hash = %q, want the new client's %q", got, want)
+	}
+}
+
+// Tokens cached before the client was saved with them are still used, and
+// refreshed tokens keep the client they were granted to.
+func TestClientHashOfCachedToken(t *testing.T) {
+	srv := newTokenServer(t)
+	store := &MemoryTokenStore{}
+	store.Save(context.Background(), withScopes(&oauth2.Token{AccessToken: "cached", RefreshToken: "rt", Expiry: time.Now().Add(time.Hour)}, []string{"email"}))
+	get := func() *oauth2.Token {
+		token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), "", []string{"email"},
+			WithTokenStore(store), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")))
+		if err != nil {
+			t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+		}
+		return token
+	}
+	if token := get(); token.AccessToken != "cached" {
+		t.Errorf("AccessToken = %q, want the token cached without a client", token.AccessToken)
+	}
+
+	hash := clientHash("client")
+	store.Save(context.Background(), withExtra(withScopes(&oauth2.Token{AccessToken: "expired", RefreshToken: "rt", Expiry: time.Now().Add(-time.Hour)}, []string{"email"}), clientHashKey, hash))
+	if token := get(); token.AccessToken != "at" || tokenClientHash(token) != hash {
+		t.Errorf("refreshed token = %q of client %q, want it refreshed for %q", token.AccessToken, tokenClientHash(token), hash)
+	}
+	if n := srv.requests("authorization_code"); n != 0 {
+		t.Errorf("%d exchanges, want none", n)
+	}
+}
+
+func TestClientHash(t *testing.T) {
+	if clientHash("a") == clientHash("b") {
+		t.Error("clientHash() is the same for different clients")
+	}
+	if h := clientHash("client"); h != clientHash("client") || len(h) != 16 {
+		t.Errorf("clientHash() = %q, want 16 stable hex digits", h)
+	}
+	if h := tokenClientHash(nil); h != "" {
+		t.Errorf("tokenClientHash(nil) = %q, want \"\"", h)
+	}
+}
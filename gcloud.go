@@ -0,0 +1,115 @@
+package gclientauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gcloudUserType is the type of gcloud's application default credentials for
+// a user, as opposed to a service account.
+const gcloudUserType = "authorized_user"
+
+// gcloudADCFile is the name of the file `gcloud auth application-default
+// login` saves the application default credentials in.
+const gcloudADCFile = "application_default_credentials.json"
+
+// gcloudADC is gcloud's JSON format of the application default credentials of
+// a user.
+type gcloudADC struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	QuotaProjectID string `json:"quota_project_id,omitempty"`
+	Type           string `json:"type"`
+}
+
+// ImportGcloudADC returns the token and oauth2 config of the application
+// default credentials saved by `gcloud auth application-default login` in the
+// file at path, or in gcloud's configuration directory if path is empty
+// ($CLOUDSDK_CONFIG, %APPDATA%\gcloud on Windows and ~/.config/gcloud
+// elsewhere).  The token only has the refresh token so its access token is
+// refreshed on first use, e.g. by config.Client.  The scopes of the config are
+// empty since gcloud doesn't save them.
+func ImportGcloudADC(path string) (*oauth2.Token, *oauth2.Config, error) {
+	if path == "" {
+		dir, err := gcloudConfigDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		path = filepath.Join(dir, gcloudADCFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, withSentinel(ErrNoCredentialFile, "unable to read application default credentials (%v). %w", path, err)
+	}
+	var adc gcloudADC
+	if err := json.Unmarshal(data, &adc); err != nil {
+		return nil, nil, withSentinel(ErrInvalidCredential, "error parsing application default credentials (%v). %w", path, err)
+	}
+	if adc.Type != gcloudUserType {
+		return nil, nil, withSentinel(ErrInvalidCredential, "application default credentials (%v) are of type %q, not %q", path, adc.Type, gcloudUserType)
+	}
+	if adc.ClientID == "" || adc.RefreshToken == "" {
+		return nil, nil, withSentinel(ErrInvalidCredential, "application default credentials (%v) lack the client ID or refresh token", path)
+	}
+	config := &oauth2.Config{
+		ClientID:     adc.ClientID,
+		ClientSecret: adc.ClientSecret,
+		Endpoint:     google.Endpoint,
+	}
+	return &oauth2.Token{RefreshToken: adc.RefreshToken}, config, nil
+}
+
+// ExportGcloudADC writes the token and the client of the config to w as
+// gcloud's application default credentials, the format of
+// application_default_credentials.json, for tools that read it such as the
+// Google Cloud client libraries.  Only the refresh token is written so it
+// returns ErrNoRefreshToken if the token has none.  The output contains
+// secrets and must be kept where other users can't read it.
+func ExportGcloudADC(token *oauth2.Token, config *oauth2.Config, w io.Writer) error {
+	if token == nil || token.RefreshToken == "" {
+		return ErrNoRefreshToken
+	}
+	if config == nil || config.ClientID == "" {
+		return withSentinel(ErrInvalidCredential, "unable to export application default credentials without a client ID")
+	}
+	// gcloud indents with two spaces.
+	data, err := json.MarshalIndent(gcloudADC{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RefreshToken: token.RefreshToken,
+		Type:         gcloudUserType,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode application default credentials. %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("unable to write application default credentials. %w", err)
+	}
+	return nil
+}
+
+// gcloudConfigDir returns gcloud's configuration directory.
+func gcloudConfigDir() (string, error) {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			return filepath.Join(dir, "gcloud"), nil
+		}
+		return "", fmt.Errorf("unable to find gcloud's configuration directory, %%APPDATA%% isn't set")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find gcloud's configuration directory. %w", err)
+	}
+	return filepath.Join(home, ".config", "gcloud"), nil
+}
@@ -0,0 +1,166 @@
+package gclientauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// sampleADC is application default credentials as saved by `gcloud auth
+// application-default login`.
+const sampleADC = "testdata/application_default_credentials.json"
+
+func TestImportGcloudADC(t *testing.T) {
+	token, config, err := ImportGcloudADC(sampleADC)
+	if err != nil {
+		t.Fatalf("ImportGcloudADC() error = %v", err)
+	}
+	if token.RefreshToken != "1//0example-refresh-token" || token.AccessToken != "" {
+		t.Errorf("token = %+v, want only the refresh token", token)
+	}
+	if config.ClientID != "123456789012-example.apps.googleusercontent.com" || config.ClientSecret != "example-secret" {
+		t.Errorf("client = %q, %q, want the one of the file", config.ClientID, config.ClientSecret)
+	}
+	if config.Endpoint != google.Endpoint {
+		t.Errorf("Endpoint = %+v, want Google's", config.Endpoint)
+	}
+
+	// The token is refreshed with the client of the file on first use.
+	srv := newTokenServer(t)
+	config.Endpoint = srv.endpoint()
+	refreshed, err := config.TokenSource(context.Background(), token).Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if refreshed.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want the refreshed token", refreshed.AccessToken)
+	}
+	form := srv.lastForm()
+	if form.Get("grant_type") != "refresh_token" || form.Get("refresh_token") != token.RefreshToken || form.Get("client_id") != config.ClientID {
+		t.Errorf("refresh request = %v, want the refresh token and client of the file", form)
+	}
+}
+
+// sampleADCDir returns a directory with the sample ADC file for gcloud's
+// configuration directory.
+func sampleADCDir(t *testing.T) string {
+	data, err := os.ReadFile(sampleADC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, gcloudADCFile), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestImportGcloudADCDefaultPath(t *testing.T) {
+	setenv(t, "CLOUDSDK_CONFIG", sampleADCDir(t))
+	if token, _, err := ImportGcloudADC(""); err != nil || token.RefreshToken == "" {
+		t.Errorf("ImportGcloudADC() from $CLOUDSDK_CONFIG = %+v, %v, want the token", token, err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(sampleADCDir(t), filepath.Join(home, ".config", "gcloud")); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "CLOUDSDK_CONFIG", "")
+	setenv(t, "HOME", home)
+	if token, _, err := ImportGcloudADC(""); err != nil || token.RefreshToken == "" {
+		t.Errorf("ImportGcloudADC() from ~/.config/gcloud = %+v, %v, want the token", token, err)
+	}
+}
+
+func TestImportGcloudADCErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{name: "not JSON", data: "{", want: ErrInvalidCredential},
+		{name: "service account", data: `{"type":"service_account","client_id":"c","private_key":"k"}`, want: ErrInvalidCredential},
+		{name: "no refresh token", data: `{"type":"authorized_user","client_id":"c","client_secret":"s"}`, want: ErrInvalidCredential},
+		{name: "no client", data: `{"type":"authorized_user","refresh_token":"rt"}`, want: ErrInvalidCredential},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ImportGcloudADC(credentialFile(t, []byte(tt.data))); !errors.Is(err, tt.want) {
+				t.Errorf("ImportGcloudADC() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, _, err := ImportGcloudADC(filepath.Join(t.TempDir(), gcloudADCFile)); !errors.Is(err, ErrNoCredentialFile) {
+		t.Errorf("ImportGcloudADC() of a missing file error = %v, want %v", err, ErrNoCredentialFile)
+	}
+}
+
+func TestExportGcloudADC(t *testing.T) {
+	token := &oauth2.Token{AccessToken: "at", RefreshToken: "rt", Expiry: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	config := &oauth2.Config{ClientID: "client", ClientSecret: "secret", Scopes: []string{"email"}}
+	var out bytes.Buffer
+	if err := ExportGcloudADC(token, config, &out); err != nil {
+		t.Fatalf("ExportGcloudADC() error = %v", err)
+	}
+	golden(t, "gcloud_adc.golden", out.Bytes())
+
+	// What is exported can be imported again and read by the Google libraries.
+	path := credentialFile(t, out.Bytes())
+	imported, importedConfig, err := ImportGcloudADC(path)
+	if err != nil {
+		t.Fatalf("ImportGcloudADC() of the export error = %v", err)
+	}
+	if imported.RefreshToken != "rt" || importedConfig.ClientID != "client" || importedConfig.ClientSecret != "secret" {
+		t.Errorf("ImportGcloudADC() of the export = %+v, %+v, want the token and client", imported, importedConfig)
+	}
+	if _, err := google.CredentialsFromJSON(context.Background(), out.Bytes(), "email"); err != nil {
+		t.Errorf("google.CredentialsFromJSON() of the export error = %v", err)
+	}
+}
+
+func TestExportGcloudADCErrors(t *testing.T) {
+	config := &oauth2.Config{ClientID: "client", ClientSecret: "secret"}
+	tests := []struct {
+		name   string
+		token  *oauth2.Token
+		config *oauth2.Config
+		want   error
+	}{
+		{name: "nil token", config: config, want: ErrNoRefreshToken},
+		{name: "no refresh token", token: &oauth2.Token{AccessToken: "at"}, config: config, want: ErrNoRefreshToken},
+		{name: "nil config", token: &oauth2.Token{RefreshToken: "rt"}, want: ErrInvalidCredential},
+		{name: "no client ID", token: &oauth2.Token{RefreshToken: "rt"}, config: &oauth2.Config{ClientSecret: "secret"}, want: ErrInvalidCredential},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := ExportGcloudADC(tt.token, tt.config, &out); !errors.Is(err, tt.want) || out.Len() != 0 {
+				t.Errorf("ExportGcloudADC() = %q, %v, want nothing written and %v", out.String(), err, tt.want)
+			}
+		})
+	}
+
+	closed, err := os.Create(filepath.Join(t.TempDir(), gcloudADCFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	if err := ExportGcloudADC(&oauth2.Token{RefreshToken: "rt"}, config, closed); err == nil || !strings.Contains(err.Error(), "unable to write") {
+		t.Errorf("ExportGcloudADC() to a closed file error = %v, want the write failure", err)
+	}
+}
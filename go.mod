@@ -1,5 +1,10 @@
 module lazyhacker.dev/gclientauth
 
-go 1.14
+go 1.16
 
-require golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+require (
+	github.com/zalando/go-keyring v0.2.1
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	golang.org/x/term v0.0.0-20210220032956-6a3ed077a48d
+)
@@ -0,0 +1,204 @@
+package gclientauth
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenResponse is what the fake token endpoint responds with by default.
+const tokenResponse = `{"access_token":"at","refresh_token":"rt","expires_in":3600,"token_type":"Bearer","scope":"email"}`
+
+// tokenServer is a fake authorization server.  Its token endpoint responds
+// with response, or with what respond returns if it is set.
+type tokenServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	response string
+	respond  func(w http.ResponseWriter, r *http.Request)
+	forms    []url.Values
+}
+
+// newTokenServer returns a fake authorization server that is closed when the
+// test ends.
+func newTokenServer(t *testing.T) *tokenServer {
+	s := &tokenServer{response: tokenResponse}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		s.mu.Lock()
+		s.forms = append(s.forms, r.PostForm)
+		respond, response := s.respond, s.response
+		s.mu.Unlock()
+		if respond != nil {
+			respond(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// endpoint returns the endpoint of the server for WithEndpoint.  Its auth
+// style is set so the oauth2 package doesn't send failed requests again with
+// the other style.
+func (s *tokenServer) endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{AuthURL: s.URL + "/auth", TokenURL: s.URL + "/token", AuthStyle: oauth2.AuthStyleInParams}
+}
+
+// requests returns the number of requests to the server with the grant type.
+func (s *tokenServer) requests(grantType string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, f := range s.forms {
+		if f.Get("grant_type") == grantType {
+			n++
+		}
+	}
+	return n
+}
+
+// lastForm returns the form of the last request to the server.
+func (s *tokenServer) lastForm() url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.forms) == 0 {
+		return nil
+	}
+	return s.forms[len(s.forms)-1]
+}
+
+// fakeIDToken returns an unsigned ID token JWT with the JSON claims.
+func fakeIDToken(claims string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+// webCredential returns a web application credential with the redirect URIs.
+func webCredential(redirectURIs ...string) []byte {
+	return []byte(fmt.Sprintf(`{"web":{"client_id":"web-client","client_secret":"secret","redirect_uris":["%v"],"auth_uri":"https://accounts.example.com/auth","token_uri":"https://accounts.example.com/token"}}`,
+		strings.Join(redirectURIs, `","`)))
+}
+
+// installedCredential returns a desktop/other credential of the client.
+func installedCredential(clientID string) []byte {
+	return []byte(fmt.Sprintf(`{"installed":{"client_id":"%v","client_secret":"secret","redirect_uris":["urn:ietf:wg:oauth:2.0:oob","http://localhost"],"auth_uri":"https://accounts.example.com/auth","token_uri":"https://accounts.example.com/token"}}`,
+		clientID))
+}
+
+// credentialFile writes the credential to a file in a temporary directory and
+// returns its path.
+func credentialFile(t *testing.T, credential []byte) string {
+	path := filepath.Join(t.TempDir(), "credential.json")
+	if err := os.WriteFile(path, credential, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setenv sets the environment variable until the test ends.
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// cachePath returns the path of a token file in a temporary directory.
+func cachePath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "token.json")
+}
+
+// redirectingBrowser returns a browser opener that does what the browser does
+// once the user authorized the application: it requests the redirect URI of
+// the authorization URL with the state and query, e.g. "code=c".  The
+// redirect URI requested is sent to redirects if it isn't nil.
+func redirectingBrowser(t *testing.T, query string, redirects chan<- string) func(string) error {
+	return func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		redirect := u.Query().Get("redirect_uri")
+		if redirects != nil {
+			redirects <- redirect
+		}
+		go func() {
+			resp, err := insecureClient.Get(redirect + "?state=" + url.QueryEscape(u.Query().Get("state")) + "&" + query)
+			if err != nil {
+				t.Errorf("redirect to %v failed: %v", redirect, err)
+				return
+			}
+			resp.Body.Close()
+		}()
+		return nil
+	}
+}
+
+// rewriteTransport sends the requests to the host of target.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// rewriteTo returns a rewriteTransport to the server.
+func rewriteTo(t *testing.T, srv *httptest.Server) rewriteTransport {
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rewriteTransport{target: target}
+}
+
+// insecureClient is an HTTP client that accepts the self-signed certificates
+// of WithTLS.
+var insecureClient = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+// recordingLogger is a Logger that keeps the messages.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+// contains returns whether a message contains s.
+func (l *recordingLogger) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
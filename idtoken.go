@@ -0,0 +1,66 @@
+package gclientauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// IDClaims are the standard OpenID Connect claims of a Google ID token.
+type IDClaims struct {
+	Issuer        string `json:"iss"`
+	Sub           string `json:"sub"`
+	Audience      string `json:"aud"`
+	IssuedAt      int64  `json:"iat"`
+	Expiry        int64  `json:"exp"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	Locale        string `json:"locale"`
+	HostedDomain  string `json:"hd"`
+}
+
+// ParseIDToken returns the claims of the ID token the token endpoint returned
+// with the token when the openid scope (and email and profile for those
+// claims) was requested.  The ID token's signature isn't verified, which is
+// fine for tokens received directly from Google over TLS but not for ID tokens
+// passed on by someone else.
+func ParseIDToken(token *oauth2.Token) (*IDClaims, error) {
+	if token == nil {
+		return nil, errors.New("no token")
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, errors.New("token has no ID token, request the openid scope")
+	}
+	var claims IDClaims
+	if err := decodeIDTokenClaims(idToken, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// decodeIDTokenClaims decodes the claims of the ID token JWT without verifying
+// its signature.  This is fine for tokens received directly from Google's
+// token endpoint over TLS.
+func decodeIDTokenClaims(idToken string, v interface{}) error {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fmt.Errorf("unable to decode ID token. %w", err)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("unable to decode ID token claims. %w", err)
+	}
+	return nil
+}
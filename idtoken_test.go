@@ -0,0 +1,46 @@
+package gclientauth
+
+import (
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// idTokenClaims are the claims of the ID token fixture.
+const idTokenClaims = `{"iss":"https://accounts.google.com","sub":"110169484474386276334","aud":"client","iat":1577836800,"exp":1577840400,` +
+	`"email":"user@example.com","email_verified":true,"name":"Test User","given_name":"Test","family_name":"User","hd":"example.com"}`
+
+func TestParseIDToken(t *testing.T) {
+	token := (&oauth2.Token{AccessToken: "at"}).WithExtra(map[string]interface{}{"id_token": fakeIDToken(idTokenClaims)})
+	claims, err := ParseIDToken(token)
+	if err != nil {
+		t.Fatalf("ParseIDToken() error = %v", err)
+	}
+	want := IDClaims{
+		Issuer: "https://accounts.google.com", Sub: "110169484474386276334", Audience: "client", IssuedAt: 1577836800, Expiry: 1577840400,
+		Email: "user@example.com", EmailVerified: true, Name: "Test User", GivenName: "Test", FamilyName: "User", HostedDomain: "example.com",
+	}
+	if *claims != want {
+		t.Errorf("ParseIDToken() = %+v, want %+v", *claims, want)
+	}
+}
+
+func TestParseIDTokenErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+	}{
+		{name: "nil token"},
+		{name: "no ID token", token: &oauth2.Token{AccessToken: "at"}},
+		{name: "not a JWT", token: (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": "abc"})},
+		{name: "bad encoding", token: (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": "a.!!!.c"})},
+		{name: "not JSON", token: (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": fakeIDToken("claims")})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if claims, err := ParseIDToken(tt.token); err == nil {
+				t.Errorf("ParseIDToken() = %+v, want an error", claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+// Defaults of KeyringTokenStore.
+const (
+	defaultKeyringService = "gclientauth"
+	defaultKeyringAccount = "default"
+)
+
+// KeyringTokenStore is a TokenStore that keeps the token in the keyring of the
+// operating system: the Keychain on macOS, the Credential Manager on Windows
+// and the Secret Service (e.g. GNOME Keyring or KWallet) on Linux and BSD.  It
+// is safer than a file on laptops since the refresh token isn't readable by
+// anything that can read the user's files.
+//
+// Where there is no keyring, e.g. over SSH or in containers, the token is kept
+// in Fallback instead if it is set.  Tests can use the in-memory keyring of
+// keyring.MockInit from github.com/zalando/go-keyring.
+type KeyringTokenStore struct {
+	// Service is the name of the keyring entry.  Defaults to "gclientauth".
+	Service string
+	// Account identifies the token within Service, e.g. the profile set
+	// with WithProfile.  Defaults to "default".
+	Account string
+	// Fallback is the store used when the keyring isn't available.  Without
+	// it the keyring's error is returned.
+	Fallback TokenStore
+}
+
+// Load reads the token from the keyring.  The error wraps os.ErrNotExist if
+// there is no token in the keyring.
+func (s KeyringTokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	secret, err := keyring.Get(s.service(), s.account())
+	if err != nil {
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil, fmt.Errorf("no token in the keyring (%v/%v). %w", s.service(), s.account(), os.ErrNotExist)
+		}
+		if s.useFallback(err) {
+			return s.Fallback.Load(ctx)
+		}
+		return nil, fmt.Errorf("unable to read the token from the keyring (%v/%v). %w", s.service(), s.account(), err)
+	}
+	token, migrated, err := decodeToken([]byte(secret))
+	if err != nil {
+		return nil, decodeError(fmt.Sprintf("the token in the keyring (%v/%v)", s.service(), s.account()), err)
+	}
+	if migrated {
+		// The token can still be used if it can't be rewritten.
+		s.Save(ctx, token)
+	}
+	return token, nil
+}
+
+// Save writes the token to the keyring, replacing the previous one.
+func (s KeyringTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	data, err := encodeToken(token)
+	if err != nil {
+		return fmt.Errorf("unable to encode the token. %w", err)
+	}
+	if err := keyring.Set(s.service(), s.account(), string(data)); err != nil {
+		if s.useFallback(err) {
+			return s.Fallback.Save(ctx, token)
+		}
+		return fmt.Errorf("unable to write the token to the keyring (%v/%v). %w", s.service(), s.account(), err)
+	}
+	return nil
+}
+
+// Delete removes the token from the keyring and from Fallback if it supports
+// Delete.  It isn't an error if there is no token.
+func (s KeyringTokenStore) Delete(ctx context.Context) error {
+	err := keyring.Delete(s.service(), s.account())
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) && !s.useFallback(err) {
+		return fmt.Errorf("unable to delete the token from the keyring (%v/%v). %w", s.service(), s.account(), err)
+	}
+	if d, ok := s.Fallback.(interface {
+		Delete(ctx context.Context) error
+	}); ok {
+		return d.Delete(ctx)
+	}
+	return nil
+}
+
+// useFallback returns whether err from the keyring means it isn't available
+// and the token is to be kept in Fallback instead.
+func (s KeyringTokenStore) useFallback(err error) bool {
+	return s.Fallback != nil && !errors.Is(err, keyring.ErrNotFound)
+}
+
+// service returns the name of the keyring entry.
+func (s KeyringTokenStore) service() string {
+	if s.Service == "" {
+		return defaultKeyringService
+	}
+	return s.Service
+}
+
+// account returns the account of the token within the keyring entry.
+func (s KeyringTokenStore) account() string {
+	if s.Account == "" {
+		return defaultKeyringAccount
+	}
+	return s.Account
+}
@@ -0,0 +1,125 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+func TestKeyringTokenStore(t *testing.T) {
+	keyring.MockInit()
+	ctx := context.Background()
+	store := KeyringTokenStore{Account: "work"}
+	if _, err := store.Load(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load() before Save() error = %v, want a not-exist error", err)
+	}
+
+	want := withScopes(&oauth2.Token{AccessToken: "at", RefreshToken: "rt", Expiry: time.Now().Add(time.Hour).Round(time.Second)}, []string{"email"})
+	if err := store.Save(ctx, want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got.AccessToken != "at" || got.RefreshToken != "rt" || !got.Expiry.Equal(want.Expiry) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+	if scopes := GrantedScopes(got); len(scopes) != 1 || scopes[0] != "email" {
+		t.Errorf("GrantedScopes() = %q, want the scopes it was saved with", scopes)
+	}
+	secret, err := keyring.Get("gclientauth", "work")
+	if err != nil || secret == "" {
+		t.Errorf("keyring entry gclientauth/work = %q, %v, want the token", secret, err)
+	}
+
+	// Other accounts keep their own tokens.
+	if _, err := (KeyringTokenStore{}).Load(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load() of the default account error = %v, want a not-exist error", err)
+	}
+
+	if err := store.Delete(ctx); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Load(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load() after Delete() error = %v, want a not-exist error", err)
+	}
+	if err := store.Delete(ctx); err != nil {
+		t.Errorf("Delete() of a missing token error = %v, want nil", err)
+	}
+}
+
+func TestKeyringTokenStoreCorrupt(t *testing.T) {
+	keyring.MockInit()
+	if err := keyring.Set("gclientauth", "default", "{"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (KeyringTokenStore{}).Load(context.Background()); !errors.Is(err, ErrCorruptCache) {
+		t.Errorf("Load() error = %v, want %v", err, ErrCorruptCache)
+	}
+}
+
+// Logout of an empty keyring has nothing to revoke.
+func TestKeyringTokenStoreLogout(t *testing.T) {
+	keyring.MockInit()
+	if err := Logout(context.Background(), KeyringTokenStore{}); err != nil {
+		t.Errorf("Logout() error = %v, want nil", err)
+	}
+}
+
+func TestKeyringTokenStoreUseFallback(t *testing.T) {
+	unavailable := errors.New("org.freedesktop.secrets was not provided by any .service files")
+	tests := []struct {
+		name     string
+		fallback TokenStore
+		err      error
+		want     bool
+	}{
+		{name: "unavailable", fallback: &MemoryTokenStore{}, err: unavailable, want: true},
+		{name: "not found", fallback: &MemoryTokenStore{}, err: keyring.ErrNotFound, want: false},
+		{name: "no fallback", err: unavailable, want: false},
+	}
+	for _, tt := range tests {
+		if got := (KeyringTokenStore{Fallback: tt.fallback}).useFallback(tt.err); got != tt.want {
+			t.Errorf("%v: useFallback() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeyringTokenStoreUpgradesOnLoad(t *testing.T) {
+	keyring.MockInit()
+	if err := keyring.Set("gclientauth", "default", `{"access_token":"at","refresh_token":"rt"}`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := (KeyringTokenStore{}).Load(context.Background())
+	if err != nil || token.AccessToken != "at" || token.RefreshToken != "rt" {
+		t.Fatalf("Load() = %+v, %v, want the bare token", token, err)
+	}
+	secret, err := keyring.Get("gclientauth", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := cachedVersion(t, []byte(secret)); v != cacheVersion {
+		t.Errorf("keyring entry after Load() = %s, want version %v", secret, cacheVersion)
+	}
+}
+
+func TestKeyringTokenStoreNoToken(t *testing.T) {
+	keyring.MockInit()
+	for _, secret := range []string{"{}", "null", `{"version":1,"token":null}`} {
+		if err := keyring.Set("gclientauth", "default", secret); err != nil {
+			t.Fatal(err)
+		}
+		if token, err := (KeyringTokenStore{}).Load(context.Background()); !errors.Is(err, ErrCorruptCache) || token != nil {
+			t.Errorf("Load() of %s = %v, %v, want %v", secret, token, err, ErrCorruptCache)
+		}
+		if got, _ := keyring.Get("gclientauth", "default"); got != secret {
+			t.Errorf("keyring entry after Load() = %s, want %s unchanged", got, secret)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package gclientauth
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// pathLocks serializes the use of each token file within the process.
+var pathLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: make(map[string]*sync.Mutex)}
+
+// pathMutex returns the mutex of the token file at path.
+func pathMutex(path string) *sync.Mutex {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	pathLocks.Lock()
+	defer pathLocks.Unlock()
+	mu, ok := pathLocks.m[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		pathLocks.m[path] = mu
+	}
+	return mu
+}
+
+// storePath returns the path of the file of the package's file based stores
+// or "" for other stores.
+func storePath(store TokenStore) string {
+	switch s := store.(type) {
+	case FileTokenStore:
+		return s.Path
+	case EncryptedFileTokenStore:
+		return s.Path
+	case KeyringTokenStore:
+		return storePath(s.Fallback)
+	}
+	return ""
+}
+
+// lockStore locks the file of store within the process and, if set with
+// WithFileLock, against other processes.  The returned function unlocks it.
+// Stores that aren't backed by a file aren't locked.
+func (o *options) lockStore(store TokenStore) (func(), error) {
+	path := storePath(store)
+	if path == "" {
+		return func() {}, nil
+	}
+	mu := pathMutex(path)
+	mu.Lock()
+	if !o.fileLock {
+		return mu.Unlock, nil
+	}
+	// The token file itself is replaced when it is saved so the lock is
+	// held on a separate file.
+	f, err := lockFile(path + ".lock")
+	if err != nil {
+		mu.Unlock()
+		return nil, fmt.Errorf("unable to lock token file (%v). %w", path, err)
+	}
+	return func() {
+		unlockFile(f)
+		mu.Unlock()
+	}, nil
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package gclientauth
+
+import "os"
+
+// lockFile does nothing on platforms without flock, leaving the token file
+// unprotected against other processes.
+func lockFile(path string) (*os.File, error) {
+	return nil, nil
+}
+
+// unlockFile does nothing on platforms without flock.
+func unlockFile(f *os.File) {}
@@ -0,0 +1,60 @@
+package gclientauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentCallsAuthorizeOnce(t *testing.T) {
+	for _, fileLock := range []bool{false, true} {
+		t.Run(fmt.Sprintf("WithFileLock(%v)", fileLock), func(t *testing.T) {
+			srv := newTokenServer(t)
+			var mu sync.Mutex
+			n := 0
+			srv.respond = func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				n++
+				i := n
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"access_token":"at-%d","refresh_token":"rt","expires_in":3600,"token_type":"Bearer","scope":"email"}`, i)
+			}
+			path := cachePath(t)
+
+			const calls = 10
+			tokens := make([]string, calls)
+			var wg sync.WaitGroup
+			for i := 0; i < calls; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), path, []string{"email"},
+						WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")), WithFileLock(fileLock))
+					if err != nil {
+						t.Errorf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+						return
+					}
+					tokens[i] = token.AccessToken
+				}(i)
+			}
+			wg.Wait()
+
+			if got := srv.requests("authorization_code"); got != 1 {
+				t.Errorf("%d authorizations, want 1", got)
+			}
+			for i, token := range tokens {
+				if token != "at-1" {
+					t.Errorf("call %d got token %q, want the single token at-1", i, token)
+				}
+			}
+			if saved, err := (FileTokenStore{Path: path}).Load(context.Background()); err != nil || saved.AccessToken != "at-1" {
+				t.Errorf("cached token = %v, %v, want at-1", saved, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package gclientauth
+
+// Logger receives the informational and warning messages of the package.  It
+// is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// nopLogger is a Logger that discards all messages.  It is the default so
+// applications using the package stay quiet.
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
@@ -0,0 +1,45 @@
+package gclientauth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// MemoryTokenStore is a TokenStore that keeps the token in memory only, for
+// short-lived processes and tests that shouldn't write to disk.  The zero value
+// is an empty store.  It is safe for concurrent use.
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// Load returns the saved token.  Like FileTokenStore's, the error wraps
+// os.ErrNotExist if no token has been saved yet.
+func (s *MemoryTokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return nil, fmt.Errorf("no token in the memory store. %w", os.ErrNotExist)
+	}
+	return s.token, nil
+}
+
+// Save keeps the token, replacing the previous one.
+func (s *MemoryTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	return nil
+}
+
+// Delete forgets the token.
+func (s *MemoryTokenStore) Delete(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = nil
+	return nil
+}
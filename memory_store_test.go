@@ -0,0 +1,51 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestMemoryTokenStore(t *testing.T) {
+	ctx := context.Background()
+	var store MemoryTokenStore
+	if _, err := store.Load(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load() before Save() error = %v, want a not-exist error", err)
+	}
+	for _, access := range []string{"first", "second"} {
+		if err := store.Save(ctx, &oauth2.Token{AccessToken: access}); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if token, err := store.Load(ctx); err != nil || token.AccessToken != access {
+			t.Errorf("Load() = %v, %v, want the token %q", token, err, access)
+		}
+	}
+	if err := store.Delete(ctx); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Load(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load() after Delete() error = %v, want a not-exist error", err)
+	}
+}
+
+func TestMemoryTokenStoreConcurrent(t *testing.T) {
+	ctx := context.Background()
+	store := &MemoryTokenStore{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store.Save(ctx, &oauth2.Token{AccessToken: fmt.Sprint(i)})
+			if _, err := store.Load(ctx); err != nil {
+				t.Errorf("Load() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
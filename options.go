@@ -0,0 +1,841 @@
+package gclientauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// AccessType is whether the application can refresh the token without the
+// user being present.
+type AccessType string
+
+const (
+	// AccessTypeOffline requests a refresh token so the token can be
+	// refreshed without the user.
+	AccessTypeOffline AccessType = "offline"
+	// AccessTypeOnline doesn't request a refresh token so the user has to
+	// authorize the application again once the token expires.
+	AccessTypeOnline AccessType = "online"
+)
+
+// defaultExpiryDelta is how long before their expiry tokens are refreshed so
+// requests started just before the expiry don't fail.
+const defaultExpiryDelta = 30 * time.Second
+
+// Option changes the default behavior of GetGoogleOauth2Token.
+type Option func(*options)
+
+// AuthURLOption is an Option of GetAuthURL.  It is the same type so the
+// options of the other functions, e.g. WithPKCE and WithLoginHint, can be
+// passed to it.
+type AuthURLOption = Option
+
+// options holds the settings that can be changed with an Option.
+type options struct {
+	browser   bool
+	noBrowser bool
+	port      string
+	portSet   bool
+	store     TokenStore
+	profile   string
+	app       string
+	fileMode  os.FileMode
+	fileLock  bool
+	pkce      *bool
+	subject   string
+
+	nonInteractive  bool
+	requireState    bool
+	silent          bool
+	successPage     string
+	successRedirect string
+	authTimeout     time.Duration
+	tls             bool
+	listenAddress   string
+	redirectPath    string
+	incrementalAuth bool
+	forceConsent    bool
+	loginHint       string
+	hostedDomain    string
+	accessType      AccessType
+	authCodeOpts    []oauth2.AuthCodeOption
+	expiryDelta     time.Duration
+	credentialEnv   string
+	endpoint        *oauth2.Endpoint
+	deviceAuthURL   string
+	quotaProject    string
+	userAgent       string
+	dryRun          bool
+
+	exchangeAttempts int
+	exchangeBackoff  time.Duration
+	noManualFallback bool
+
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	idleTimeout       time.Duration
+
+	httpClient  *http.Client
+	transport   http.RoundTripper
+	openBrowser func(url string) error
+	now         func() time.Time
+	onListen    func(addr string)
+	listener    net.Listener
+	logger      Logger
+	prompt      io.Writer
+	hyperlinks  bool
+	signals     bool
+	notify      func(c chan<- os.Signal, sig ...os.Signal)
+	stopNotify  func(c chan<- os.Signal)
+	clipboard   bool
+	qrCode      bool
+	copyText    func(text string) error
+	codeReader  io.Reader
+}
+
+// newOptions returns the default options with opts applied in order so later
+// options take precedence over earlier ones.
+func newOptions(opts ...Option) *options {
+	o := &options{
+		accessType:        AccessTypeOffline,
+		expiryDelta:       defaultExpiryDelta,
+		credentialEnv:     defaultCredentialEnv,
+		deviceAuthURL:     googleDeviceAuthURL,
+		readHeaderTimeout: defaultReadHeaderTimeout,
+		readTimeout:       defaultReadTimeout,
+		idleTimeout:       defaultIdleTimeout,
+		openBrowser:       openURL,
+		now:               time.Now,
+		copyText:          copyToClipboard,
+		notify:            signal.Notify,
+		stopNotify:        signal.Stop,
+		logger:            nopLogger{},
+		prompt:            os.Stdout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithBrowser sets whether the authorization URL is opened in the user's
+// browser for desktop/other credentials. If false (the default), the URL is
+// only printed.
+func WithBrowser(browser bool) Option {
+	return func(o *options) {
+		o.browser = browser
+	}
+}
+
+// WithNoBrowser sets whether the authorization URL is never opened in a
+// browser, for any kind of credential, and only printed for the user to open,
+// e.g. when the platform's command opens the wrong browser.  It takes
+// precedence over WithBrowser.
+func WithNoBrowser(noBrowser bool) Option {
+	return func(o *options) {
+		o.noBrowser = noBrowser
+	}
+}
+
+// WithPort sets the port the local web server listens on for web application
+// credentials whose redirect URL has no port.  The redirect URL's port is used
+// if it has one, since the browser is sent to it, and a warning is logged if
+// port contradicts it.  Without WithPort, the port of a redirect URL without
+// one is the port the browser connects to for its scheme: 80 for http and 443
+// for https or with WithTLS.
+//
+// If port is empty or "0", a free port is picked by the operating system and
+// the redirect URL is changed to use it. The redirect URLs registered for the
+// credential must then accept any port.
+func WithPort(port string) Option {
+	return func(o *options) {
+		o.port, o.portSet = port, true
+	}
+}
+
+// callbackPort returns the port the local web server listens on for the
+// redirect URL, warning if the port set with WithPort isn't used.
+func (o *options) callbackPort(redirect *url.URL) string {
+	port := o.listenPort(redirect)
+	if o.portSet && o.port != port {
+		o.logger.Printf("(WARNING) The web server listens on the redirect URL's port %v instead of port %v.", port, o.port)
+	}
+	return port
+}
+
+// listenPort returns the port the local web server listens on for the
+// redirect URL: its port, or if it has none the port set with WithPort or the
+// default port of its scheme, which is https with WithTLS.
+func (o *options) listenPort(redirect *url.URL) string {
+	if p := redirect.Port(); p != "" {
+		return p
+	}
+	if o.portSet {
+		return o.port
+	}
+	if o.tls || redirect.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// WithTokenStore sets where the token is loaded from and saved to.  It
+// replaces the cachedtoken file passed to GetGoogleOauth2Token.
+func WithTokenStore(store TokenStore) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// tokenStore returns the TokenStore set with WithTokenStore or, if there
+// isn't one, a FileTokenStore for the cachedtoken file or, if a profile is set
+// with WithProfile, for the profile's file in the cachedtoken directory.  An
+// empty cachedtoken is the DefaultCachePath of the application, or its
+// DefaultProfileDir with a profile.  If cachedtoken is an existing directory,
+// the file in it is the ScopedCacheFile of config.
+func (o *options) tokenStore(cachedtoken string, config *oauth2.Config) (TokenStore, error) {
+	if o.store != nil {
+		return o.store, nil
+	}
+	cachePath, profileDir := DefaultCachePath, DefaultProfileDir
+	if o.dryRun {
+		// Nothing is created in a dry run.
+		cachePath, profileDir = defaultCachePath, defaultProfileDir
+	}
+	if o.profile != "" {
+		dir := cachedtoken
+		if dir == "" {
+			var err error
+			if dir, err = profileDir(o.appName()); err != nil {
+				return nil, err
+			}
+		}
+		path, err := ProfilePath(dir, o.profile)
+		if err != nil {
+			return nil, err
+		}
+		return FileTokenStore{Path: path, Mode: o.fileMode}, nil
+	}
+	if cachedtoken == "" {
+		path, err := cachePath(o.appName())
+		if err != nil {
+			return nil, err
+		}
+		cachedtoken = path
+	}
+	if fi, err := os.Stat(cachedtoken); err == nil && fi.IsDir() {
+		cachedtoken = filepath.Join(cachedtoken, ScopedCacheFile(config.ClientID, config.Scopes))
+	}
+	return FileTokenStore{Path: cachedtoken, Mode: o.fileMode}, nil
+}
+
+// WithProfile sets the name of the profile whose token is used, so tokens of
+// several accounts can be kept side by side.  The cachedtoken passed to
+// GetGoogleOauth2Token is then the directory of the profiles, the
+// DefaultProfileDir if it is empty, and the token is cached in its
+// <profile>.json file.  The name can't contain path separators or "..".  See
+// ListProfiles.
+func WithProfile(profile string) Option {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
+// WithAppName sets the name of the application used for the directory of the
+// DefaultCachePath when the cachedtoken passed to GetGoogleOauth2Token is
+// empty.  Defaults to the name of the executable.
+func WithAppName(name string) Option {
+	return func(o *options) {
+		o.app = name
+	}
+}
+
+// appName returns the name set with WithAppName or the executable's name.
+func (o *options) appName() string {
+	if o.app != "" {
+		return o.app
+	}
+	name := filepath.Base(os.Args[0])
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// WithTokenFileMode sets the permission of the cachedtoken file.  Defaults to
+// 0600 so only the user can read it.  It has no effect when a TokenStore is set
+// with WithTokenStore.
+func WithTokenFileMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.fileMode = mode
+	}
+}
+
+// WithFileLock sets whether the token file is also locked against other
+// processes while the token is loaded, refreshed or authorized and saved, so
+// processes started together authorize only once.  It uses flock(2) and a
+// <file>.lock file next to the token file, so it only protects against other
+// processes that use it too, and it has no effect on platforms without flock,
+// such as Windows.  Calls within the process are always serialized.
+func WithFileLock(lock bool) Option {
+	return func(o *options) {
+		o.fileLock = lock
+	}
+}
+
+// WithPKCE sets whether PKCE (RFC 7636) is used to protect the exchange of the
+// authorization code.  Defaults to true for desktop/other credentials and false
+// for web application credentials.
+func WithPKCE(pkce bool) Option {
+	return func(o *options) {
+		o.pkce = &pkce
+	}
+}
+
+// usePKCE returns whether to use PKCE for desktop/other credentials (installed)
+// or web application credentials.
+func (o *options) usePKCE(installed bool) bool {
+	if o.pkce != nil {
+		return *o.pkce
+	}
+	return installed
+}
+
+// WithSubject sets the email address of the user GetServiceAccountToken
+// impersonates using domain-wide delegation.
+func WithSubject(email string) Option {
+	return func(o *options) {
+		o.subject = email
+	}
+}
+
+// WithBrowserOpener sets the function that opens the authorization URL in the
+// user's browser, e.g. to use wslview on WSL or to only print the URL.
+// Defaults to the platform's command for opening URLs.
+func WithBrowserOpener(open func(url string) error) Option {
+	return func(o *options) {
+		o.openBrowser = open
+	}
+}
+
+// WithNonInteractive sets whether the user can't be asked to enter the
+// authorization code for desktop/other credentials, making
+// GetGoogleOauth2Token return ErrNonInteractive instead of waiting for input.
+// By default this is detected by checking whether stdin is a terminal.
+func WithNonInteractive(nonInteractive bool) Option {
+	return func(o *options) {
+		o.nonInteractive = nonInteractive
+	}
+}
+
+// WithRequireState sets whether the user must enter the whole URL the browser
+// was redirected to, rather than only the code, for desktop/other credentials
+// so the state of the response is always verified against CSRF.  By default a
+// code alone is accepted, but the state of a URL is always verified.
+func WithRequireState(require bool) Option {
+	return func(o *options) {
+		o.requireState = require
+	}
+}
+
+// WithSuccessPage sets the HTML page shown in the browser once the local web
+// server has received the authorization code, e.g. to show the application's
+// logo and tell the user they may close the tab.
+func WithSuccessPage(html string) Option {
+	return func(o *options) {
+		o.successPage = html
+	}
+}
+
+// WithSuccessRedirect sets the URL the browser is redirected to once the local
+// web server has received the authorization code.  It takes precedence over
+// WithSuccessPage.
+func WithSuccessRedirect(url string) Option {
+	return func(o *options) {
+		o.successRedirect = url
+	}
+}
+
+// WithAuthTimeout sets how long to wait for the user to authorize the
+// application in the browser for web application credentials before giving up
+// with ErrAuthTimeout.  Defaults to waiting forever.
+func WithAuthTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.authTimeout = timeout
+	}
+}
+
+// WithTLS sets whether the local web server for web application credentials
+// serves HTTPS, for clients whose redirect URL must be https even on
+// localhost.  The server uses a self-signed certificate generated for the
+// flow, so the browser will warn about it, and the redirect URL's scheme is
+// changed to https.
+func WithTLS(tls bool) Option {
+	return func(o *options) {
+		o.tls = tls
+	}
+}
+
+// WithListenAddress sets the host the local web server for web application
+// credentials listens on.  Defaults to the host of the redirect URL, except
+// that localhost is bound to 127.0.0.1 so it doesn't resolve to an IPv6
+// address the browser doesn't connect to.
+func WithListenAddress(host string) Option {
+	return func(o *options) {
+		o.listenAddress = host
+	}
+}
+
+// WithRedirectPath sets the path of the redirect URL for web application
+// credentials, replacing the path of the credential's redirect URL.  It must
+// be one of the redirect URLs registered for the credential.  The local web
+// server only accepts the authorization response on this path.
+func WithRedirectPath(path string) Option {
+	return func(o *options) {
+		o.redirectPath = path
+	}
+}
+
+// WithManualFallback sets whether the user is asked to enter the URL the
+// browser was redirected to, as for desktop/other credentials, when the local
+// web server for web application credentials can't be started, e.g. because
+// the port is in use.  Defaults to true.
+func WithManualFallback(fallback bool) Option {
+	return func(o *options) {
+		o.noManualFallback = !fallback
+	}
+}
+
+// WithServerTimeouts sets the timeouts of the local web server for web
+// application credentials, see http.Server.  Timeouts that aren't positive
+// keep their defaults of 10 seconds to read the request headers, 30 seconds to
+// read the request and 60 seconds for idle connections.
+func WithServerTimeouts(readHeader, read, idle time.Duration) Option {
+	return func(o *options) {
+		if readHeader > 0 {
+			o.readHeaderTimeout = readHeader
+		}
+		if read > 0 {
+			o.readTimeout = read
+		}
+		if idle > 0 {
+			o.idleTimeout = idle
+		}
+	}
+}
+
+// WithListenerCallback sets a function that is called with the address the
+// local web server for web application credentials listens on once it is
+// started, e.g. to log it when the port is picked by the operating system.
+func WithListenerCallback(callback func(addr string)) Option {
+	return func(o *options) {
+		o.onListen = callback
+	}
+}
+
+// WithListener sets the TCP listener the local web server for web application
+// credentials accepts connections on instead of listening itself, e.g. a
+// socket bound with particular options or passed in by systemd socket
+// activation.  The port of the redirect URL is set to the listener's, and
+// WithPort and WithListenAddress are ignored.  The listener is closed when the
+// web server stops, so it can only be used for one flow: a closed listener is
+// rejected.
+func WithListener(listener net.Listener) Option {
+	return func(o *options) {
+		o.listener = listener
+	}
+}
+
+// WithBindAddress is WithListenAddress, e.g. to bind the local web server to a
+// particular network interface of a multi-homed machine or container.  A
+// warning is logged if the browser can't reach the server at the host of the
+// redirect URL.
+func WithBindAddress(host string) Option {
+	return WithListenAddress(host)
+}
+
+// checkListenHost logs a warning if the host the local web server listens on
+// isn't reachable at the host of the redirect URL the browser is sent to.
+func (o *options) checkListenHost(redirectHost string) {
+	host := o.listenHost(redirectHost)
+	ip := net.ParseIP(host)
+	switch {
+	case host == redirectHost, ip != nil && ip.IsUnspecified():
+		// The same host or all interfaces.
+	case isLoopback(host) && isLoopback(redirectHost):
+		// localhost resolves to the loopback address.
+	default:
+		o.logger.Printf("(WARNING) The web server listens on %v which the browser may not reach at the redirect URL's host %v.", host, redirectHost)
+	}
+}
+
+// isLoopback returns whether host is localhost or a loopback address.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listenHost returns the host the local web server listens on for the host of
+// the redirect URL.
+func (o *options) listenHost(redirectHost string) string {
+	if o.listenAddress != "" {
+		return o.listenAddress
+	}
+	if redirectHost == "localhost" {
+		return "127.0.0.1"
+	}
+	return redirectHost
+}
+
+// WithLogger sets the Logger that receives the informational and warning
+// messages of the package.  By default they are discarded.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithPromptWriter sets where the prompts for the user, such as the
+// authorization URL to visit, are written.  Defaults to os.Stdout.
+func WithPromptWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.prompt = w
+	}
+}
+
+// WithSilent sets whether the package writes nothing for the user, leaving
+// presentation to the caller.  For desktop/other credentials the user can't be
+// asked for the authorization code so GetGoogleOauth2Token returns
+// ErrNonInteractive when authorization is required; use GetAuthURL and
+// ExchangeCode to show the authorization URL and get the code yourself.
+func WithSilent(silent bool) Option {
+	return func(o *options) {
+		o.silent = silent
+	}
+}
+
+// promptWriter returns where to write the prompts for the user.
+func (o *options) promptWriter() io.Writer {
+	if o.silent {
+		return io.Discard
+	}
+	return o.prompt
+}
+
+// WithHyperlinks sets whether the URLs written for the user are terminal
+// hyperlinks (OSC 8) the user can click in terminals that support them.  They
+// are only written when the prompts go to a terminal.
+func WithHyperlinks(hyperlinks bool) Option {
+	return func(o *options) {
+		o.hyperlinks = hyperlinks
+	}
+}
+
+// link returns the URL to write for the user, as a terminal hyperlink if
+// enabled with WithHyperlinks and the prompts go to a terminal.
+func (o *options) link(url string) string {
+	f, ok := o.promptWriter().(*os.File)
+	return formatLink(url, o.hyperlinks && ok && isTerminal(f))
+}
+
+// formatLink returns the URL as an OSC 8 terminal hyperlink if hyperlink is
+// set, or as it is otherwise.
+func formatLink(url string, hyperlink bool) string {
+	if !hyperlink {
+		return url
+	}
+	return "\x1b]8;;" + url + "\x1b\\" + url + "\x1b]8;;\x1b\\"
+}
+
+// WithClipboard sets whether the authorization URL is copied to the system
+// clipboard when it isn't opened in a browser, so it can be pasted into a
+// browser, e.g. on another machine.  It uses pbcopy, clip, or wl-copy, xclip,
+// xsel and clip.exe on other systems.
+func WithClipboard(clipboard bool) Option {
+	return func(o *options) {
+		o.clipboard = clipboard
+	}
+}
+
+// showURL asks the user to visit the authorization URL, copying it to the
+// clipboard if enabled with WithClipboard.
+func (o *options) showURL(url string) {
+	fmt.Fprintf(o.promptWriter(), "Visit the URL for the auth dialog: \n\t%v\n", o.link(url))
+	o.showQRCode(url)
+	if !o.clipboard {
+		return
+	}
+	if err := o.copyText(url); err != nil {
+		o.logger.Printf("Unable to copy the authorization URL to the clipboard. %v", err)
+		return
+	}
+	fmt.Fprintln(o.promptWriter(), "The URL has been copied to the clipboard.")
+}
+
+// WithQRCode sets whether a QR code of the authorization URL, or of the
+// verification URL of GetDeviceToken, is written with the URL so it can be
+// opened on a phone.  The QR code is drawn with Unicode block characters for
+// terminals with light text on a dark background.
+func WithQRCode(qrCode bool) Option {
+	return func(o *options) {
+		o.qrCode = qrCode
+	}
+}
+
+// showQRCode writes the QR code of the URL if enabled with WithQRCode.
+func (o *options) showQRCode(url string) {
+	if !o.qrCode {
+		return
+	}
+	qr, err := qrRender(url)
+	if err != nil {
+		o.logger.Printf("Unable to show the URL as a QR code. %v", err)
+		return
+	}
+	fmt.Fprint(o.promptWriter(), qr)
+}
+
+// WithCodeReader sets where the authorization code entered by the user for
+// desktop/other credentials is read from, e.g. a pipe or a GUI prompt.
+// Defaults to os.Stdin.
+func WithCodeReader(r io.Reader) Option {
+	return func(o *options) {
+		o.codeReader = r
+	}
+}
+
+// WithIncrementalAuth sets whether the scopes the user already granted the
+// application are included in the new token, so scopes can be added over time
+// without asking for all of them at once.
+func WithIncrementalAuth(incremental bool) Option {
+	return func(o *options) {
+		o.incrementalAuth = incremental
+	}
+}
+
+// WithForceConsent sets whether the user is always shown the consent page
+// (prompt=consent).  Google only returns a refresh token the first time the
+// user consents, so this guarantees a new refresh token, e.g. after the old
+// one was lost or revoked.
+func WithForceConsent(force bool) Option {
+	return func(o *options) {
+		o.forceConsent = force
+	}
+}
+
+// WithLoginHint sets the email address of the account the user is asked to
+// sign in with, so users with several accounts don't pick the wrong one.
+func WithLoginHint(email string) Option {
+	return func(o *options) {
+		o.loginHint = email
+	}
+}
+
+// WithHostedDomain restricts sign-in to accounts of the Google Workspace
+// domain.  The restriction on the sign-in page is only advisory so, when the
+// token includes an ID token (the openid scope is requested), its hd claim is
+// also checked and ErrHostedDomainMismatch returned if it doesn't match.
+// Servers should still verify the domain themselves.
+func WithHostedDomain(domain string) Option {
+	return func(o *options) {
+		o.hostedDomain = domain
+	}
+}
+
+// WithAccessType sets whether a refresh token is requested.  Defaults to
+// AccessTypeOffline.
+func WithAccessType(accessType AccessType) Option {
+	return func(o *options) {
+		o.accessType = accessType
+	}
+}
+
+// WithAuthCodeOptions adds options to the authorization URL for parameters
+// that have no Option of their own.  They are applied after the parameters set
+// by the other options, including PKCE, and override them.  The state can't be
+// overridden without breaking its verification.
+func WithAuthCodeOptions(opts ...oauth2.AuthCodeOption) Option {
+	return func(o *options) {
+		o.authCodeOpts = append(o.authCodeOpts, opts...)
+	}
+}
+
+// WithExpiryDelta sets how long before its expiry a token is considered
+// expired and refreshed, so requests started just before the expiry don't
+// fail mid-flight.  Defaults to 30 seconds.
+func WithExpiryDelta(delta time.Duration) Option {
+	return func(o *options) {
+		o.expiryDelta = delta
+	}
+}
+
+// WithClock sets the function returning the current time used wherever the
+// expiry of tokens is evaluated, e.g. so tests can move past an expiry
+// without waiting.  Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// valid returns whether the token has an access token that doesn't expire
+// within the expiry delta.
+func (o *options) valid(token *oauth2.Token) bool {
+	if token == nil || token.AccessToken == "" {
+		return false
+	}
+	return token.Expiry.IsZero() || o.now().Add(o.expiryDelta).Before(token.Expiry)
+}
+
+// WithHTTPClient sets the HTTP client used for the requests to Google, such as
+// the token exchange and refresh, e.g. to go through a proxy or to send them
+// to a test server.  The client returned by GetGoogleClient uses its transport
+// too.  Defaults to the client set in the context with oauth2.HTTPClient or
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithTransport sets the transport of the HTTP requests to Google, both for
+// getting and refreshing tokens and, under the transport that authorizes
+// them, for the requests of the client returned by GetGoogleClient, e.g. to
+// add retries, logging or metrics.  It replaces the transport of the client
+// set with WithHTTPClient.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// client returns the HTTP client set with WithHTTPClient and WithTransport or
+// nil if neither is set.
+func (o *options) client() *http.Client {
+	if o.transport == nil {
+		return o.httpClient
+	}
+	c := &http.Client{}
+	if o.httpClient != nil {
+		*c = *o.httpClient
+	}
+	c.Transport = o.transport
+	return c
+}
+
+// context returns ctx with the client from client, where the oauth2 package
+// and contextClient look for it.
+func (o *options) context(ctx context.Context) context.Context {
+	c := o.client()
+	if c == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, c)
+}
+
+// WithExchangeRetry sets how many times the exchange of the authorization code
+// for a token is attempted when it fails with a server (5xx) or network
+// error, so the user doesn't have to authorize the application again because
+// of a transient failure.  The wait between attempts starts at backoff and
+// doubles every attempt, with some random jitter.  Errors such as
+// invalid_grant aren't retried.  Defaults to a single attempt.
+func WithExchangeRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.exchangeAttempts = attempts
+		o.exchangeBackoff = backoff
+	}
+}
+
+// WithEndpoint replaces the Google endpoint of the credential file, e.g. to
+// use a test server or a proxy.  For GetServiceAccountToken only its TokenURL
+// is used.
+func WithEndpoint(endpoint oauth2.Endpoint) Option {
+	return func(o *options) {
+		o.endpoint = &endpoint
+	}
+}
+
+// WithDeviceAuthURL sets the device authorization endpoint of GetDeviceToken,
+// e.g. to use a test server along with WithEndpoint.  Defaults to Google's.
+func WithDeviceAuthURL(url string) Option {
+	return func(o *options) {
+		o.deviceAuthURL = url
+	}
+}
+
+// WithCredentialEnv sets the environment variable with the path of the
+// credential file used when the credential passed is empty.  Defaults to
+// GOOGLE_APPLICATION_CREDENTIALS.
+func WithCredentialEnv(name string) Option {
+	return func(o *options) {
+		o.credentialEnv = name
+	}
+}
+
+// WithSignalHandling sets whether SIGINT (Ctrl-C) and SIGTERM stop waiting for
+// the authorization code of web application credentials, returning
+// ErrInterrupted after the local web server is closed, instead of terminating
+// the program.  The signals are only handled while waiting.
+func WithSignalHandling(handle bool) Option {
+	return func(o *options) {
+		o.signals = handle
+	}
+}
+
+// interrupts returns the channel that receives the signals handled with
+// WithSignalHandling, nil if they aren't handled, and the function that stops
+// handling them.
+func (o *options) interrupts() (<-chan os.Signal, func()) {
+	if !o.signals {
+		return nil, func() {}
+	}
+	c := make(chan os.Signal, 1)
+	o.notify(c, os.Interrupt, syscall.SIGTERM)
+	return c, func() { o.stopNotify(c) }
+}
+
+// WithQuotaProject sets the project whose quota and billing the requests of
+// the HTTP clients returned by the package are attributed to, with the
+// X-Goog-User-Project header.  It is often required for calling APIs with
+// user credentials.
+func WithQuotaProject(projectID string) Option {
+	return func(o *options) {
+		o.quotaProject = projectID
+	}
+}
+
+// WithUserAgent sets the product the requests of the HTTP clients returned by
+// the package identify themselves with, e.g. "myapp/1.2".  It is appended to
+// the User-Agent the requests already have.
+func WithUserAgent(ua string) Option {
+	return func(o *options) {
+		o.userAgent = ua
+	}
+}
+
+// WithDryRun sets whether GetGoogleOauth2Token and Authenticate only log how
+// the token would be got, i.e. the kind of flow, the scopes, the redirect URL,
+// the token cache and the authorization URL, to the Logger set with WithLogger
+// and return ErrDryRun, without loading the cached token or making any
+// requests.  Nothing is written either: no directory is created for the token
+// cache and no port is listened on.  For web application credentials the
+// redirect URL is the first loopback redirect URI, without checking that its
+// port is free, and its port may still change if it is picked by the
+// operating system.
+func WithDryRun(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRun = dryRun
+	}
+}
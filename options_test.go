@@ -0,0 +1,251 @@
+package gclientauth
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestNewOptionsDefaults(t *testing.T) {
+	o := newOptions()
+	if o.browser {
+		t.Error("browser = true, want false")
+	}
+	if o.portSet {
+		t.Errorf("port is set to %q without WithPort", o.port)
+	}
+	if o.store != nil {
+		t.Errorf("store = %v, want nil", o.store)
+	}
+	if o.accessType != AccessTypeOffline {
+		t.Errorf("accessType = %q, want %q", o.accessType, AccessTypeOffline)
+	}
+	if o.expiryDelta != defaultExpiryDelta {
+		t.Errorf("expiryDelta = %v, want %v", o.expiryDelta, defaultExpiryDelta)
+	}
+	if _, ok := o.logger.(nopLogger); !ok {
+		t.Errorf("logger = %T, want nopLogger", o.logger)
+	}
+}
+
+func TestNewOptionsPrecedence(t *testing.T) {
+	o := newOptions(WithPort("1"), WithBrowser(true), WithPort("2"), WithBrowser(false))
+	if o.port != "2" {
+		t.Errorf("port = %q, want the later %q", o.port, "2")
+	}
+	if o.browser {
+		t.Error("browser = true, want the later false")
+	}
+
+	store := FileTokenStore{Path: "b"}
+	o = newOptions(WithTokenStore(FileTokenStore{Path: "a"}), WithTokenStore(store))
+	if o.store != store {
+		t.Errorf("store = %v, want the later %v", o.store, store)
+	}
+}
+
+func TestListenHost(t *testing.T) {
+	tests := []struct {
+		opts     []Option
+		redirect string
+		want     string
+	}{
+		{redirect: "localhost", want: "127.0.0.1"},
+		{redirect: "127.0.0.1", want: "127.0.0.1"},
+		{redirect: "::1", want: "::1"},
+		{opts: []Option{WithListenAddress("::1")}, redirect: "localhost", want: "::1"},
+		{opts: []Option{WithBindAddress("192.0.2.1")}, redirect: "localhost", want: "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		if got := newOptions(tt.opts...).listenHost(tt.redirect); got != tt.want {
+			t.Errorf("listenHost(%q) = %q, want %q", tt.redirect, got, tt.want)
+		}
+	}
+}
+
+func TestValidExpiryDelta(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := WithClock(func() time.Time { return now })
+	soon := &oauth2.Token{AccessToken: "at", Expiry: now.Add(20 * time.Second)}
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+		opts  []Option
+		want  bool
+	}{
+		{name: "within the default margin", token: soon, want: false},
+		{name: "outside a smaller margin", token: soon, opts: []Option{WithExpiryDelta(10 * time.Second)}, want: true},
+		{name: "later", token: &oauth2.Token{AccessToken: "at", Expiry: now.Add(time.Hour)}, want: true},
+		{name: "expired", token: &oauth2.Token{AccessToken: "at", Expiry: now.Add(-time.Second)}, opts: []Option{WithExpiryDelta(0)}, want: false},
+		{name: "no expiry", token: &oauth2.Token{AccessToken: "at"}, want: true},
+		{name: "no access token", token: &oauth2.Token{Expiry: now.Add(time.Hour)}, want: false},
+		{name: "nil", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newOptions(append([]Option{clock}, tt.opts...)...).valid(tt.token); got != tt.want {
+				t.Errorf("valid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenWithinMarginIsRefreshed(t *testing.T) {
+	srv := newTokenServer(t)
+	store := &MemoryTokenStore{}
+	soon := withScopes(&oauth2.Token{AccessToken: "soon", RefreshToken: "rt", Expiry: time.Now().Add(20 * time.Second)}, []string{"email"})
+	store.Save(context.Background(), soon)
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), "", []string{"email"},
+		WithTokenStore(store), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if token.AccessToken != "at" || srv.requests("refresh_token") != 1 {
+		t.Errorf("AccessToken = %q after %d refreshes, want the token refreshed before it expires", token.AccessToken, srv.requests("refresh_token"))
+	}
+}
+
+func TestFormatLink(t *testing.T) {
+	const url = "https://accounts.example.com/auth?state=s"
+	if got, want := formatLink(url, true), "\x1b]8;;"+url+"\x1b\\"+url+"\x1b]8;;\x1b\\"; got != want {
+		t.Errorf("formatLink(true) = %q, want %q", got, want)
+	}
+	if got := formatLink(url, false); got != url {
+		t.Errorf("formatLink(false) = %q, want the plain URL", got)
+	}
+}
+
+// Hyperlinks are only written to terminals.
+func TestLinkNotTerminal(t *testing.T) {
+	const url = "https://accounts.example.com/auth"
+	f, err := os.Create(filepath.Join(t.TempDir(), "prompts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, w := range []io.Writer{&strings.Builder{}, f} {
+		for _, opts := range [][]Option{nil, {WithHyperlinks(true)}} {
+			if got := newOptions(append(opts, WithPromptWriter(w))...).link(url); got != url {
+				t.Errorf("link() to %T = %q, want the plain URL", w, got)
+			}
+		}
+	}
+}
+
+func TestCheckListenHost(t *testing.T) {
+	tests := []struct {
+		bind     string
+		redirect string
+		warn     bool
+	}{
+		{redirect: "localhost"},
+		{bind: "127.0.0.1", redirect: "localhost"},
+		{bind: "::1", redirect: "127.0.0.1"},
+		{bind: "0.0.0.0", redirect: "localhost"},
+		{bind: "::", redirect: "192.0.2.1"},
+		{bind: "192.0.2.1", redirect: "192.0.2.1"},
+		{bind: "192.0.2.1", redirect: "localhost", warn: true},
+		{bind: "127.0.0.1", redirect: "192.0.2.1", warn: true},
+	}
+	for _, tt := range tests {
+		logger := &recordingLogger{}
+		newOptions(WithBindAddress(tt.bind), WithLogger(logger)).checkListenHost(tt.redirect)
+		if got := logger.contains("(WARNING) The web server listens on"); got != tt.warn {
+			t.Errorf("checkListenHost(%q) with %q warned = %v, want %v", tt.redirect, tt.bind, got, tt.warn)
+		}
+	}
+}
+
+// The clock decides when a cached token expires, not the real time.
+func TestClockCrossesExpiry(t *testing.T) {
+	expiry := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: expiry.Add(-time.Hour)}
+	srv := newTokenServer(t)
+	store := &MemoryTokenStore{}
+	store.Save(context.Background(), withScopes(&oauth2.Token{AccessToken: "cached", RefreshToken: "rt", Expiry: expiry}, []string{"email"}))
+	get := func() string {
+		token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), "", []string{"email"},
+			WithTokenStore(store), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithClock(clock.Now))
+		if err != nil {
+			t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+		}
+		return token.AccessToken
+	}
+
+	// Long expired in real time, but not yet for the clock.
+	if got := get(); got != "cached" {
+		t.Errorf("AccessToken = %q an hour before the expiry, want the cached token", got)
+	}
+	clock.advance(time.Hour - 31*time.Second)
+	if got := get(); got != "cached" {
+		t.Errorf("AccessToken = %q before the expiry delta, want the cached token", got)
+	}
+	clock.advance(2 * time.Second)
+	if got := get(); got != "at" {
+		t.Errorf("AccessToken = %q within the expiry delta, want the refreshed token", got)
+	}
+	if n := srv.requests("refresh_token"); n != 1 {
+		t.Errorf("%d refreshes, want 1", n)
+	}
+}
+
+func TestAuthenticatorClock(t *testing.T) {
+	expiry := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: expiry.Add(-time.Minute)}
+	srv := newTokenServer(t)
+	store := &MemoryTokenStore{}
+	store.Save(context.Background(), withScopes(&oauth2.Token{AccessToken: "cached", RefreshToken: "rt", Expiry: expiry}, []string{"email"}))
+	a := newTestAuthenticator(t, srv, store, WithClock(clock.Now))
+	if token, err := a.Token(context.Background()); err != nil || token.AccessToken != "cached" {
+		t.Fatalf("Token() = %v, %v, want the cached token", token, err)
+	}
+	clock.advance(time.Minute)
+	if token, err := a.Token(context.Background()); err != nil || token.AccessToken != "at" {
+		t.Errorf("Token() after the expiry = %v, %v, want the refreshed token", token, err)
+	}
+}
+
+// The web server listens where the browser is sent: the redirect URL's port
+// or, if it has none, the port set with WithPort or the default port of its
+// scheme.
+func TestCallbackPort(t *testing.T) {
+	tests := []struct {
+		redirect string
+		opts     []Option
+		want     string
+		warn     bool
+	}{
+		{redirect: "http://localhost/cb", want: "80"},
+		{redirect: "https://localhost/cb", want: "443"},
+		{redirect: "http://localhost/cb", opts: []Option{WithTLS(true)}, want: "443"},
+		{redirect: "http://localhost:8085/cb", want: "8085"},
+		{redirect: "https://localhost:8443/cb", want: "8443"},
+		{redirect: "http://localhost/cb", opts: []Option{WithPort("8080")}, want: "8080"},
+		{redirect: "http://localhost/cb", opts: []Option{WithPort("0")}, want: "0"},
+		{redirect: "https://localhost/cb", opts: []Option{WithPort("")}, want: ""},
+		// The browser is sent to the redirect URL's port, whatever WithPort says.
+		{redirect: "http://localhost:8085/cb", opts: []Option{WithPort("8085")}, want: "8085"},
+		{redirect: "http://localhost:9090/cb", opts: []Option{WithPort("8080")}, want: "9090", warn: true},
+		{redirect: "http://localhost:9090/cb", opts: []Option{WithPort("0")}, want: "9090", warn: true},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.redirect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := &recordingLogger{}
+		if got := newOptions(append(tt.opts, WithLogger(logger))...).callbackPort(u); got != tt.want {
+			t.Errorf("callbackPort(%q) = %q, want %q", tt.redirect, got, tt.want)
+		}
+		if got := logger.contains("(WARNING) The web server listens on the redirect URL's port"); got != tt.warn {
+			t.Errorf("callbackPort(%q) warned = %v, want %v", tt.redirect, got, tt.warn)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCodeChallenge(t *testing.T) {
+	// The example of RFC 7636, appendix B.
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const want = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := codeChallenge(verifier); got != want {
+		t.Errorf("codeChallenge(%q) = %q, want %q", verifier, got, want)
+	}
+}
+
+func TestNewCodeVerifier(t *testing.T) {
+	a, err := newCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) < 43 || len(a) > 128 {
+		t.Errorf("len(verifier) = %d, want between 43 and 128", len(a))
+	}
+	if a == b {
+		t.Errorf("two verifiers are both %q", a)
+	}
+}
+
+func TestWebFlowPKCE(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want bool
+	}{
+		{name: "web credential", want: false},
+		{name: "enabled", opts: []Option{WithPKCE(true)}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTokenServer(t)
+			var authURL *url.URL
+			redirect := redirectingBrowser(t, "code=c", nil)
+			opts := append([]Option{WithPort("0"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+				WithBrowserOpener(func(u string) error {
+					authURL, _ = url.Parse(u)
+					return redirect(u)
+				})}, tt.opts...)
+			if _, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"}, opts...); err != nil {
+				t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+			}
+
+			challenge := authURL.Query().Get("code_challenge")
+			verifier := srv.lastForm().Get("code_verifier")
+			if !tt.want {
+				if challenge != "" || verifier != "" {
+					t.Errorf("code_challenge = %q, code_verifier = %q, want neither", challenge, verifier)
+				}
+				return
+			}
+			if m := authURL.Query().Get("code_challenge_method"); m != "S256" {
+				t.Errorf("code_challenge_method = %q, want S256", m)
+			}
+			if verifier == "" || codeChallenge(verifier) != challenge {
+				t.Errorf("code_challenge %q isn't the S256 challenge of code_verifier %q", challenge, verifier)
+			}
+		})
+	}
+}
+
+// pkceServer makes the token server check the code verifier against the
+// challenge of the authorization URL like Google does.
+func pkceServer(srv *tokenServer, authURL string) error {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return err
+	}
+	challenge := u.Query().Get("code_challenge")
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if codeChallenge(r.PostForm.Get("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant","error_description":"Invalid code verifier."}`)
+			return
+		}
+		io.WriteString(w, tokenResponse)
+	}
+	return nil
+}
+
+func TestAuthCodeRequestPKCE(t *testing.T) {
+	srv := newTokenServer(t)
+	config := testConfig(srv)
+	req, err := NewAuthCodeRequest(config)
+	if err != nil {
+		t.Fatalf("NewAuthCodeRequest() error = %v", err)
+	}
+	if req.Verifier == "" || req.State == "" {
+		t.Fatalf("NewAuthCodeRequest() = %+v, want a state and a verifier", req)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("state") != req.State || u.Query().Get("code_challenge") != codeChallenge(req.Verifier) {
+		t.Errorf("URL = %v, want the state %q and the challenge of the verifier", req.URL, req.State)
+	}
+	if err := pkceServer(srv, req.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another request's verifier doesn't match the challenge.
+	other, err := NewAuthCodeRequest(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExchangeCodeWithVerifier(context.Background(), config, "c", other.Verifier); !errors.Is(err, ErrTokenExchange) {
+		t.Errorf("ExchangeCodeWithVerifier() with another verifier error = %v, want %v", err, ErrTokenExchange)
+	}
+	token, err := ExchangeCodeWithVerifier(context.Background(), config, "c", req.Verifier)
+	if err != nil {
+		t.Fatalf("ExchangeCodeWithVerifier() error = %v", err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want the token", token.AccessToken)
+	}
+}
+
+// GetAuthURL keeps the verifier for ExchangeCode.
+func TestGetAuthURLPKCE(t *testing.T) {
+	srv := newTokenServer(t)
+	config := testConfig(srv)
+	authURL, state := GetAuthURL(config)
+	if err := pkceServer(srv, authURL); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(authURL, "code_challenge=") {
+		t.Fatalf("GetAuthURL() = %v, want a PKCE challenge", authURL)
+	}
+	if _, err := ExchangeCode(context.Background(), config, "c", state); err != nil {
+		t.Errorf("ExchangeCode() error = %v, want the verifier of the request", err)
+	}
+}
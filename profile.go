@@ -0,0 +1,72 @@
+package gclientauth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profileExt is the extension of the token files of profiles.
+const profileExt = ".json"
+
+// profilesDir is the name of the directory of the profiles in the directory of
+// the DefaultCachePath, so the profiles aren't mixed with the other token
+// files there.
+const profilesDir = "profiles"
+
+// ProfilePath returns the path of the token file of the profile in cacheDir.
+// It returns ErrInvalidProfile if the name is empty or contains a path
+// separator or "..", so the file is always in cacheDir.
+func ProfilePath(cacheDir, profile string) (string, error) {
+	if profile == "" || strings.ContainsAny(profile, `/\`) || strings.Contains(profile, "..") {
+		return "", withSentinel(ErrInvalidProfile, "invalid profile name %q", profile)
+	}
+	return filepath.Join(cacheDir, profile+profileExt), nil
+}
+
+// DefaultProfileDir returns the directory of the profiles for the application
+// when no cachedtoken is passed with WithProfile: the profiles directory next
+// to the application's DefaultCachePath.  The directory is created if it
+// doesn't exist.
+func DefaultProfileDir(appName string) (string, error) {
+	dir, err := defaultProfileDir(appName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, cacheDirMode); err != nil {
+		return "", fmt.Errorf("unable to create the profile directory (%v). %w", dir, err)
+	}
+	return dir, nil
+}
+
+// defaultProfileDir is DefaultProfileDir without creating the directory, e.g.
+// for WithDryRun.
+func defaultProfileDir(appName string) (string, error) {
+	path, err := defaultCachePath(appName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), profilesDir), nil
+}
+
+// ListProfiles returns the sorted names of the profiles with a token file in
+// cacheDir.
+func ListProfiles(cacheDir string) ([]string, error) {
+	files, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the profile directory (%v). %w", cacheDir, err)
+	}
+	var profiles []string
+	for _, f := range files {
+		name := f.Name()
+		// Skip the temporary files of writeFileAtomic.
+		if f.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != profileExt {
+			continue
+		}
+		profiles = append(profiles, strings.TrimSuffix(name, profileExt))
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
@@ -0,0 +1,118 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestProfilePath(t *testing.T) {
+	got, err := ProfilePath("dir", "work")
+	if err != nil || got != filepath.Join("dir", "work.json") {
+		t.Errorf("ProfilePath(dir, work) = %q, %v, want %q", got, err, filepath.Join("dir", "work.json"))
+	}
+	for _, name := range []string{"", "..", "../work", "a/b", `a\b`, "work..", "/etc/passwd"} {
+		if got, err := ProfilePath("dir", name); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("ProfilePath(dir, %q) = %q, %v, want %v", name, got, err, ErrInvalidProfile)
+		}
+	}
+}
+
+func TestInvalidProfileIsRejected(t *testing.T) {
+	dir := t.TempDir()
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), dir, []string{"email"},
+		WithProfile("../escape"), WithPromptWriter(io.Discard))
+	if !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrInvalidProfile)
+	}
+}
+
+func TestProfilesAreIsolated(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, p := range []string{"work", "home"} {
+		store, err := newOptions(WithProfile(p)).tokenStore(dir, &oauth2.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save(ctx, &oauth2.Token{AccessToken: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The temporary files of an interrupted write aren't profiles.
+	if err := os.WriteFile(filepath.Join(dir, ".work.json.123.tmp"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"work", "home"} {
+		store, err := newOptions(WithProfile(p)).tokenStore(dir, &oauth2.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := store.Load(ctx)
+		if err != nil || token.AccessToken != p {
+			t.Errorf("token of profile %v = %v, %v, want its own", p, token, err)
+		}
+	}
+	profiles, err := ListProfiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"home", "work"}; !reflect.DeepEqual(profiles, want) {
+		t.Errorf("ListProfiles() = %q, want %q", profiles, want)
+	}
+}
+
+func TestDefaultProfileDir(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skipf("$XDG_CONFIG_HOME isn't used on %v", runtime.GOOS)
+	}
+	base := t.TempDir()
+	setenv(t, "XDG_CONFIG_HOME", base)
+	ctx := context.Background()
+	config := &oauth2.Config{ClientID: "client", Scopes: []string{"email"}}
+
+	// The token files of the application that aren't profiles.
+	def, err := newOptions(WithAppName("app")).tokenStore("", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := def.Save(ctx, &oauth2.Token{AccessToken: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	appDir := filepath.Join(base, "app")
+	if err := (FileTokenStore{Path: filepath.Join(appDir, ScopedCacheFile(config.ClientID, config.Scopes))}).Save(ctx, &oauth2.Token{AccessToken: "scoped"}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := newOptions(WithAppName("app"), WithProfile("work")).tokenStore("", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(appDir, "profiles", "work.json"); store.(FileTokenStore).Path != want {
+		t.Errorf("path of the profile = %q, want %q", store.(FileTokenStore).Path, want)
+	}
+	if err := store.Save(ctx, &oauth2.Token{AccessToken: "work"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := DefaultProfileDir("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles, err := ListProfiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"work"}; !reflect.DeepEqual(profiles, want) {
+		t.Errorf("ListProfiles(DefaultProfileDir()) = %q, want %q", profiles, want)
+	}
+}
@@ -0,0 +1,182 @@
+package gclientauth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestQREncodeDimensions(t *testing.T) {
+	tests := []struct {
+		text    string
+		version int
+	}{
+		{text: "a", version: 1},
+		// 17 bytes is the capacity of version 1 with level L.
+		{text: strings.Repeat("a", 17), version: 1},
+		{text: strings.Repeat("a", 18), version: 2},
+		{text: "https://accounts.google.com/o/oauth2/auth?client_id=c&state=s", version: 4},
+		{text: strings.Repeat("a", 230), version: 9},
+		{text: strings.Repeat("a", 231), version: 10},
+		{text: strings.Repeat("a", 2953), version: 40},
+	}
+	for _, tt := range tests {
+		modules, err := qrEncode(tt.text)
+		if err != nil {
+			t.Fatalf("qrEncode(%d bytes) error = %v", len(tt.text), err)
+		}
+		size := 4*tt.version + 17
+		if len(modules) != size {
+			t.Errorf("qrEncode(%d bytes) has %d rows, want %d of version %d", len(tt.text), len(modules), size, tt.version)
+		}
+		for y, row := range modules {
+			if len(row) != size {
+				t.Fatalf("qrEncode(%d bytes) row %d has %d modules, want %d", len(tt.text), y, len(row), size)
+			}
+		}
+	}
+	if _, err := qrEncode(strings.Repeat("a", 2954)); err == nil {
+		t.Error("qrEncode() of more than the capacity of version 40 error = nil")
+	}
+}
+
+// qrFormatsL are the format information of error correction level L for each
+// mask in ISO/IEC 18004 table C.1.
+var qrFormatsL = []int{0x77C4, 0x72F3, 0x7DAA, 0x789D, 0x662F, 0x6318, 0x6C41, 0x6976}
+
+func TestQREncodeFunctionPatterns(t *testing.T) {
+	modules, err := qrEncode("https://www.google.com/device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(modules)
+	finder := []string{
+		"#######.",
+		"#.....#.",
+		"#.###.#.",
+		"#.###.#.",
+		"#.###.#.",
+		"#.....#.",
+		"#######.",
+		"........",
+	}
+	for y, row := range finder {
+		for x, c := range row {
+			dark := c == '#'
+			if modules[y][x] != dark || modules[y][size-1-x] != dark || modules[size-1-y][x] != dark {
+				t.Fatalf("finder pattern module (%d, %d) isn't dark = %v", x, y, dark)
+			}
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		if modules[6][i] != (i%2 == 0) || modules[i][6] != (i%2 == 0) {
+			t.Fatalf("timing pattern module %d isn't dark = %v", i, i%2 == 0)
+		}
+	}
+	if !modules[size-8][8] {
+		t.Error("the dark module is light")
+	}
+
+	// Both copies of the format information are the same valid one.
+	var first, second int
+	bit := func(x, y, i int) int {
+		if modules[y][x] {
+			return 1 << uint(i)
+		}
+		return 0
+	}
+	for i := 0; i <= 5; i++ {
+		first |= bit(8, i, i)
+	}
+	first |= bit(8, 7, 6) | bit(8, 8, 7) | bit(7, 8, 8)
+	for i := 9; i < 15; i++ {
+		first |= bit(14-i, 8, i)
+	}
+	for i := 0; i < 8; i++ {
+		second |= bit(size-1-i, 8, i)
+	}
+	for i := 8; i < 15; i++ {
+		second |= bit(8, size-15+i, i)
+	}
+	valid := false
+	for _, f := range qrFormatsL {
+		valid = valid || first == f
+	}
+	if !valid || first != second {
+		t.Errorf("format information = %#x and %#x, want one of %#x", first, second, qrFormatsL)
+	}
+}
+
+func TestQRVersionInformation(t *testing.T) {
+	q := newQRCode(7)
+	q.drawFunctionPatterns()
+	bits := 0
+	for i := 0; i < 18; i++ {
+		if q.modules[i/3][q.size-11+i%3] {
+			bits |= 1 << uint(i)
+		}
+	}
+	// ISO/IEC 18004 table D.1.
+	if bits != 0x07C94 {
+		t.Errorf("version information = %#x, want 0x07c94", bits)
+	}
+}
+
+func TestQRAlignmentPositions(t *testing.T) {
+	// ISO/IEC 18004 table E.1.
+	tests := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		14: {6, 26, 46, 66},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	for version, want := range tests {
+		if got := newQRCode(version).alignmentPositions(); !reflect.DeepEqual(got, want) {
+			t.Errorf("alignmentPositions() of version %d = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestQRRender(t *testing.T) {
+	modules, err := qrEncode("https://www.google.com/device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qr, err := qrRender("https://www.google.com/device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	width := len(modules) + 2*qrQuietZone
+	lines := strings.Split(strings.TrimSuffix(qr, "\n"), "\n")
+	// Each line has two rows of modules.
+	if want := (width + 1) / 2; len(lines) != want {
+		t.Errorf("qrRender() has %d lines, want %d", len(lines), want)
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(line); n != width {
+			t.Fatalf("line %d is %d characters wide, want %d", i, n, width)
+		}
+	}
+	// The quiet zone is light.
+	if lines[0] != strings.Repeat("█", width) {
+		t.Errorf("first line = %q, want the light quiet zone", lines[0])
+	}
+}
+
+func TestShowQRCode(t *testing.T) {
+	const url = "https://www.google.com/device"
+	qr, err := qrRender(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, enabled := range []bool{false, true} {
+		var out strings.Builder
+		newOptions(WithQRCode(enabled), WithPromptWriter(&out)).showURL(url)
+		if got := strings.Contains(out.String(), qr); got != enabled {
+			t.Errorf("WithQRCode(%v) wrote the QR code = %v", enabled, got)
+		}
+	}
+}
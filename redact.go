@@ -0,0 +1,39 @@
+package gclientauth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// redactKeep is how many characters of a secret are kept when it is redacted
+// so different secrets can still be told apart.
+const redactKeep = 4
+
+// redact returns the secret with all but its last characters masked.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= redactKeep {
+		return strings.Repeat("*", len(secret))
+	}
+	return strings.Repeat("*", len(secret)-redactKeep) + secret[len(secret)-redactKeep:]
+}
+
+// RedactedToken returns a description of the token for logs and debugging
+// output with its access and refresh tokens masked except for their last 4
+// characters.
+func RedactedToken(token *oauth2.Token) string {
+	if token == nil {
+		return "<nil>"
+	}
+	expiry := "never"
+	if !token.Expiry.IsZero() {
+		expiry = token.Expiry.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("{access_token: %q, token_type: %q, refresh_token: %q, expiry: %v}",
+		redact(token.AccessToken), token.TokenType, redact(token.RefreshToken), expiry)
+}
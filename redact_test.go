@@ -0,0 +1,87 @@
+package gclientauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRedact(t *testing.T) {
+	tests := map[string]string{
+		"":                "",
+		"ab":              "**",
+		"abcd":            "****",
+		"abcde":           "*bcde",
+		"ya29.a0AfH6SMBx": "***********SMBx",
+	}
+	for secret, want := range tests {
+		if got := redact(secret); got != want {
+			t.Errorf("redact(%q) = %q, want %q", secret, got, want)
+		}
+	}
+}
+
+func TestRedactedToken(t *testing.T) {
+	expiry := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	token := &oauth2.Token{AccessToken: "ya29.access-secret", TokenType: "Bearer", RefreshToken: "1//refresh-secret", Expiry: expiry}
+	got := RedactedToken(token)
+	for _, secret := range []string{token.AccessToken, token.RefreshToken, "access-secret", "refresh-secret"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("RedactedToken() = %q, contains %q", got, secret)
+		}
+	}
+	for _, want := range []string{"cret", "Bearer", "2020-01-02T03:04:05Z"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("RedactedToken() = %q, want it to contain %q", got, want)
+		}
+	}
+	if got := RedactedToken(nil); got != "<nil>" {
+		t.Errorf("RedactedToken(nil) = %q, want <nil>", got)
+	}
+	if got := RedactedToken(&oauth2.Token{AccessToken: "at"}); !strings.Contains(got, "expiry: never") {
+		t.Errorf("RedactedToken() = %q, want it to say the token never expires", got)
+	}
+}
+
+// The secrets of a refreshed token and of a code that failed to be exchanged
+// aren't logged.
+func TestSecretsAreNotLogged(t *testing.T) {
+	srv := newTokenServer(t)
+	srv.response = `{"access_token":"new-access-secret","refresh_token":"new-refresh-secret","expires_in":3600,"token_type":"Bearer","scope":"email"}`
+	store := &MemoryTokenStore{}
+	store.Save(context.Background(), withScopes(&oauth2.Token{AccessToken: "old", RefreshToken: "old-refresh-secret", Expiry: time.Now().Add(-time.Hour)}, []string{"email"}))
+	logger := &recordingLogger{}
+	if _, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), "", []string{"email"},
+		WithTokenStore(store), WithEndpoint(srv.endpoint()), WithLogger(logger), WithPromptWriter(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if !logger.contains("Refreshed the expired cached token") {
+		t.Errorf("logged %q, want the refresh", logger.lines)
+	}
+	for _, secret := range []string{"new-access-secret", "new-refresh-secret", "old-refresh-secret"} {
+		if logger.contains(secret) {
+			t.Errorf("logged %q, contains %q", logger.lines, secret)
+		}
+	}
+
+	srv.mu.Lock()
+	srv.respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid_grant"}`)
+	}
+	srv.mu.Unlock()
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), cachePath(t), []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("4/code-secret\n")))
+	if err == nil {
+		t.Fatal("GetGoogleOauth2TokenFromJSON() error = nil, want the exchange error")
+	}
+	if strings.Contains(err.Error(), "4/code-secret") {
+		t.Errorf("error = %q, contains the code", err)
+	}
+}
@@ -0,0 +1,49 @@
+package gclientauth
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// Result is the outcome of Authenticate.
+type Result struct {
+	// Token is the valid token, either cached or newly authorized.
+	Token *oauth2.Token
+	// Config is the oauth2 config of the client credential.
+	Config *oauth2.Config
+	// GrantedScopes are the scopes the user granted the token, nil if
+	// Google didn't report them.
+	GrantedScopes []string
+
+	store TokenStore
+	o     *options
+}
+
+// newResult returns the result for the token in store.
+func newResult(token *oauth2.Token, config *oauth2.Config, store TokenStore, o *options) *Result {
+	return &Result{
+		Token:         token,
+		Config:        config,
+		GrantedScopes: GrantedScopes(token),
+		store:         store,
+		o:             o,
+	}
+}
+
+// TokenSource returns a token source that refreshes the token when it expires
+// and saves the refreshed token to the token store.
+func (r *Result) TokenSource(ctx context.Context) oauth2.TokenSource {
+	ctx = r.o.context(ctx)
+	src := &earlyTokenSource{ctx: ctx, config: r.Config, o: r.o, token: r.Token}
+	return newPersistingTokenSource(ctx, src, r.store, r.Token, r.o.logger)
+}
+
+// Client returns an HTTP client that authorizes its requests with the tokens
+// of TokenSource.  Its requests use the transport set with WithHTTPClient or
+// WithTransport and have the headers set with WithQuotaProject and
+// WithUserAgent.
+func (r *Result) Client(ctx context.Context) *http.Client {
+	return r.o.newClient(ctx, r.TokenSource(ctx))
+}
@@ -0,0 +1,42 @@
+package gclientauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticateResult(t *testing.T) {
+	srv := newTokenServer(t)
+	r, err := Authenticate(context.Background(), credentialFile(t, installedCredential("client")), cachePath(t), []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")))
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if r.Token == nil || r.Token.AccessToken != "at" {
+		t.Errorf("Token = %+v, want the token", r.Token)
+	}
+	if r.Config == nil || r.Config.ClientID != "client" || !reflect.DeepEqual(r.Config.Scopes, []string{"email"}) {
+		t.Errorf("Config = %+v, want the config of the credential", r.Config)
+	}
+	if !reflect.DeepEqual(r.GrantedScopes, []string{"email"}) {
+		t.Errorf("GrantedScopes = %q, want [email]", r.GrantedScopes)
+	}
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+	resp, err := r.Client(context.Background()).Get(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "Bearer at" {
+		t.Errorf("Authorization of the Client's request = %q, want the token", body)
+	}
+}
@@ -0,0 +1,60 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// retryable returns whether the request that failed with err may succeed if
+// it is sent again: the server failed (5xx) or the request didn't get a
+// response.  Errors about the request itself, such as invalid_grant or
+// ErrHostedDomainMismatch, aren't retryable, and neither is the context being
+// done since it would be done for the retry too.  transient is the check for
+// an exchange that is tried again with another context.
+func retryable(err error) bool {
+	var re *oauth2.RetrieveError
+	if errors.As(err, &re) {
+		return re.Response == nil || re.Response.StatusCode >= 500
+	}
+	return !errors.Is(err, ErrHostedDomainMismatch) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// backoffDelay returns how long to wait before the retry after the attempt
+// (starting at 0): backoff doubled for each attempt, with a random jitter of
+// up to half of it so clients don't retry in lockstep.
+func backoffDelay(backoff time.Duration, attempt int) time.Duration {
+	d := backoff << uint(attempt)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// withRetry calls f up to attempts times until it returns nil or an error
+// that isn't retryable, waiting with backoffDelay between the calls.  It
+// gives up early with the context's error if ctx is done.
+func withRetry(ctx context.Context, attempts int, backoff time.Duration, f func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(backoffDelay(backoff, i-1))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+		if err = f(); err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// flakyServer returns a fake authorization server whose token endpoint fails
+// with status the first failures times.
+func flakyServer(t *testing.T, failures, status int) *tokenServer {
+	srv := newTokenServer(t)
+	n := 0
+	srv.respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if n < failures {
+			n++
+			w.WriteHeader(status)
+			io.WriteString(w, `{"error":"failure"}`)
+			return
+		}
+		io.WriteString(w, tokenResponse)
+	}
+	return srv
+}
+
+func TestExchangeRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int
+		wantErr  bool
+		wantReqs int
+	}{
+		{name: "fails twice then succeeds", status: http.StatusServiceUnavailable, attempts: 3, wantReqs: 3},
+		{name: "too few attempts", status: http.StatusServiceUnavailable, attempts: 2, wantErr: true, wantReqs: 2},
+		{name: "invalid_grant isn't retried", status: http.StatusBadRequest, attempts: 3, wantErr: true, wantReqs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := flakyServer(t, 2, tt.status)
+			token, err := ExchangeCodeWithVerifier(context.Background(), testConfig(srv), "c", "", WithExchangeRetry(tt.attempts, time.Millisecond))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExchangeCodeWithVerifier() = %v, %v, want error %v", token, err, tt.wantErr)
+			}
+			if got := srv.requests("authorization_code"); got != tt.wantReqs {
+				t.Errorf("%d exchanges, want %d", got, tt.wantReqs)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	response := func(status int) *oauth2.RetrieveError {
+		return &oauth2.RetrieveError{Response: &http.Response{StatusCode: status}}
+	}
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+		transient bool
+	}{
+		{name: "server error", err: response(http.StatusServiceUnavailable), retryable: true, transient: true},
+		{name: "no response", err: &oauth2.RetrieveError{}, retryable: true, transient: true},
+		{name: "network error", err: errors.New("connection reset"), retryable: true, transient: true},
+		{name: "invalid grant", err: response(http.StatusBadRequest), retryable: false, transient: false},
+		{name: "hosted domain", err: withSentinel(ErrHostedDomainMismatch, "other domain"), retryable: false, transient: false},
+		{name: "cancelled", err: context.Canceled, retryable: false, transient: true},
+		{name: "deadline", err: fmt.Errorf("exchange. %w", context.DeadlineExceeded), retryable: false, transient: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.retryable {
+				t.Errorf("retryable() = %v, want %v", got, tt.retryable)
+			}
+			if got := transient(tt.err); got != tt.transient {
+				t.Errorf("transient() = %v, want %v", got, tt.transient)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 0; attempt < 4; attempt++ {
+		d := 100 * time.Millisecond << uint(attempt)
+		for i := 0; i < 20; i++ {
+			if got := backoffDelay(100*time.Millisecond, attempt); got < d/2 || got > d {
+				t.Errorf("backoffDelay(100ms, %d) = %v, want between %v and %v", attempt, got, d/2, d)
+			}
+		}
+	}
+}
+
+func TestWithRetryContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := withRetry(ctx, 3, time.Hour, func() error {
+		calls++
+		cancel()
+		return errors.New("connection reset")
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("withRetry() = %v after %d calls, want %v after 1", err, calls, context.Canceled)
+	}
+}
@@ -0,0 +1,73 @@
+package gclientauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/oauth2"
+)
+
+// googleRevokeURL is Google's token revocation endpoint.
+const googleRevokeURL = "https://oauth2.googleapis.com/revoke"
+
+// RevokeToken revokes the token at Google so it can't be used anymore.  The
+// refresh token is revoked if there is one, which also revokes the access
+// tokens issued from it.  A token that is already invalid isn't an error.
+func RevokeToken(ctx context.Context, token *oauth2.Token) error {
+	if token == nil {
+		return errors.New("no token to revoke")
+	}
+	t := token.RefreshToken
+	if t == "" {
+		t = token.AccessToken
+	}
+
+	status, body, err := postForm(ctx, googleRevokeURL, url.Values{"token": {t}})
+	if err != nil {
+		return fmt.Errorf("unable to revoke token. %w", err)
+	}
+	switch {
+	case status == http.StatusOK:
+		return nil
+	case status == http.StatusBadRequest && bytes.Contains(body, []byte("invalid_token")):
+		// Already expired or revoked.
+		return nil
+	default:
+		return fmt.Errorf("unable to revoke token (status %v). %s", status, body)
+	}
+}
+
+// Logout revokes the token in store and then deletes it from the store if the
+// store has a Delete(ctx) error method, as FileTokenStore,
+// EncryptedFileTokenStore, KeyringTokenStore and MemoryTokenStore do.
+//
+// Revoking is best-effort: the token is deleted even if it can't be loaded,
+// e.g. because the cache is corrupt, or revoked, e.g. because Google can't be
+// reached, so the user is always logged out locally.  The error of loading or
+// revoking the token is returned after it is deleted.  A store without a
+// token, whose Load returns an error wrapping os.ErrNotExist, isn't an error.
+func Logout(ctx context.Context, store TokenStore) error {
+	var rerr error
+	token, err := store.Load(ctx)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Nothing to revoke.
+	case err != nil:
+		rerr = fmt.Errorf("unable to load the token to revoke. %w", err)
+	default:
+		rerr = RevokeToken(ctx, token)
+	}
+	if d, ok := store.(interface {
+		Delete(ctx context.Context) error
+	}); ok {
+		if err := d.Delete(ctx); err != nil {
+			return fmt.Errorf("unable to delete the token. %w", err)
+		}
+	}
+	return rerr
+}
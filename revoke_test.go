@@ -0,0 +1,128 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// revokeServer is a fake revocation endpoint that responds with status and
+// body.
+type revokeServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	tokens []string // revoked tokens
+}
+
+// newRevokeServer returns a fake revocation endpoint and a context whose HTTP
+// client sends the requests for googleRevokeURL to it.
+func newRevokeServer(t *testing.T, status int, body string) (*revokeServer, context.Context) {
+	s := &revokeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		s.mu.Lock()
+		s.tokens = append(s.tokens, r.PostForm.Get("token"))
+		s.mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(s.Close)
+	client := &http.Client{Transport: rewriteTo(t, s.Server)}
+	return s, context.WithValue(context.Background(), oauth2.HTTPClient, client)
+}
+
+// revoked returns the tokens revoked at the server.
+func (s *revokeServer) revoked() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokens...)
+}
+
+func TestRevokeToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   *oauth2.Token
+		status  int
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{name: "refresh token", token: &oauth2.Token{AccessToken: "at", RefreshToken: "rt"}, status: http.StatusOK, want: "rt"},
+		{name: "access token", token: &oauth2.Token{AccessToken: "at"}, status: http.StatusOK, want: "at"},
+		{name: "already invalid", token: &oauth2.Token{RefreshToken: "rt"}, status: http.StatusBadRequest, body: `{"error":"invalid_token"}`, want: "rt"},
+		{name: "server error", token: &oauth2.Token{RefreshToken: "rt"}, status: http.StatusInternalServerError, want: "rt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, ctx := newRevokeServer(t, tt.status, tt.body)
+			err := RevokeToken(ctx, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RevokeToken() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := srv.revoked(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("revoked %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	srv, ctx := newRevokeServer(t, http.StatusOK, "")
+	store := FileTokenStore{Path: cachePath(t)}
+	if err := store.Save(ctx, &oauth2.Token{AccessToken: "at", RefreshToken: "rt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Logout(ctx, store); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if got := srv.revoked(); len(got) != 1 || got[0] != "rt" {
+		t.Errorf("revoked %q, want the refresh token", got)
+	}
+	if _, err := os.Stat(store.Path); !os.IsNotExist(err) {
+		t.Errorf("the token file still exists: %v", err)
+	}
+}
+
+func TestLogoutIsBestEffort(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string // contents of the token file, none if empty
+		status  int
+		wantErr error
+	}{
+		{name: "corrupt cache", data: "{", status: http.StatusOK, wantErr: ErrCorruptCache},
+		{name: "revocation fails", data: `{"access_token":"at","refresh_token":"rt"}`, status: http.StatusServiceUnavailable},
+		{name: "no token", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ctx := newRevokeServer(t, tt.status, "")
+			store := FileTokenStore{Path: cachePath(t)}
+			if tt.data != "" {
+				if err := os.WriteFile(store.Path, []byte(tt.data), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := Logout(ctx, store)
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("Logout() error = %v, want %v", err, tt.wantErr)
+			case tt.data == "" && err != nil:
+				t.Errorf("Logout() error = %v, want nil without a token", err)
+			case tt.status != http.StatusOK && err == nil:
+				t.Error("Logout() error = nil, want the revocation error")
+			}
+			if _, err := os.Stat(store.Path); !os.IsNotExist(err) {
+				t.Errorf("the token file still exists: %v", err)
+			}
+		})
+	}
+}
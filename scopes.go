@@ -0,0 +1,182 @@
+package gclientauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// grantedAtKey is the extra field of a token holding when it was granted.
+const grantedAtKey = "granted_at"
+
+// clientHashKey is the extra field of a token holding the clientHash of the
+// client it was granted to.
+const clientHashKey = "client_hash"
+
+// extraKeys are the extra fields of a token that are kept when it is copied
+// with a changed extra field.
+var extraKeys = []string{"id_token", "scope", grantedAtKey, clientHashKey}
+
+// scopeAliases maps the short names of scopes to the URLs Google reports them
+// as in the granted scopes of a token.
+var scopeAliases = map[string]string{
+	"email":   "https://www.googleapis.com/auth/userinfo.email",
+	"profile": "https://www.googleapis.com/auth/userinfo.profile",
+}
+
+// shortScopes are the scopes that aren't URLs.
+var shortScopes = map[string]bool{"openid": true, "email": true, "profile": true}
+
+// cleanScopes returns the scopes trimmed, sorted and without duplicates so the
+// same set of scopes always gives the same request.  ErrInvalidScope is
+// returned for scopes that are empty or neither a URL nor a short name.
+func cleanScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	cleaned := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, withSentinel(ErrInvalidScope, "empty scope in %q", scopes)
+		}
+		if !shortScopes[s] {
+			if u, err := url.Parse(s); err != nil || u.Scheme == "" || u.Host == "" || strings.ContainsAny(s, " \t\n") {
+				return nil, withSentinel(ErrInvalidScope, "scope %q is neither a URL nor one of openid, email and profile", s)
+			}
+		}
+		if !seen[s] {
+			seen[s] = true
+			cleaned = append(cleaned, s)
+		}
+	}
+	sort.Strings(cleaned)
+	return cleaned, nil
+}
+
+// ScopesFromFile returns the scopes in the file, one per line or separated by
+// commas, trimmed, sorted and without duplicates.  Empty lines and lines
+// starting with # are ignored.
+func ScopesFromFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read scopes file (%v). %w", path, err)
+	}
+	var scopes []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, s := range strings.Split(line, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	scopes, err = cleanScopes(scopes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scopes file (%v). %w", path, err)
+	}
+	return scopes, nil
+}
+
+// normalizeScope returns the scope as Google reports it in granted scopes.
+func normalizeScope(scope string) string {
+	if s, ok := scopeAliases[scope]; ok {
+		return s
+	}
+	return scope
+}
+
+// GrantedScopes returns the scopes granted to the token as reported by the
+// token endpoint, or nil if they aren't known.  Tokens loaded from the token
+// stores of this package keep the scopes they were saved with.
+func GrantedScopes(token *oauth2.Token) []string {
+	if token == nil {
+		return nil
+	}
+	s, ok := token.Extra("scope").(string)
+	if !ok {
+		return nil
+	}
+	return strings.Fields(s)
+}
+
+// grantedAt returns when the token was granted, or the zero time if it isn't
+// known.
+func grantedAt(token *oauth2.Token) time.Time {
+	if token == nil {
+		return time.Time{}
+	}
+	t, _ := token.Extra(grantedAtKey).(time.Time)
+	return t
+}
+
+// clientHash returns the hash of the client ID that is persisted with tokens so
+// tokens of another client are recognized without persisting the client ID.
+func clientHash(clientID string) string {
+	sum := sha256.Sum256([]byte(clientID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// tokenClientHash returns the clientHash of the client the token was granted
+// to, or "" if it isn't known.
+func tokenClientHash(token *oauth2.Token) string {
+	if token == nil {
+		return ""
+	}
+	h, _ := token.Extra(clientHashKey).(string)
+	return h
+}
+
+// withExtra returns a copy of the token with the extra field key set to value.
+func withExtra(token *oauth2.Token, key string, value interface{}) *oauth2.Token {
+	extra := make(map[string]interface{})
+	for _, k := range extraKeys {
+		if v := token.Extra(k); v != nil {
+			extra[k] = v
+		}
+	}
+	extra[key] = value
+	return token.WithExtra(extra)
+}
+
+// withScopes returns a copy of the token whose granted scopes are scopes.
+func withScopes(token *oauth2.Token, scopes []string) *oauth2.Token {
+	return withExtra(token, "scope", strings.Join(scopes, " "))
+}
+
+// inheritGrant returns the token refreshed from prev with the granted scopes,
+// grant time and client of prev if the token endpoint didn't report them.
+func inheritGrant(token, prev *oauth2.Token) *oauth2.Token {
+	if GrantedScopes(token) == nil && GrantedScopes(prev) != nil {
+		token = withScopes(token, GrantedScopes(prev))
+	}
+	if grantedAt(token).IsZero() && !grantedAt(prev).IsZero() {
+		token = withExtra(token, grantedAtKey, grantedAt(prev))
+	}
+	if tokenClientHash(token) == "" && tokenClientHash(prev) != "" {
+		token = withExtra(token, clientHashKey, tokenClientHash(prev))
+	}
+	return token
+}
+
+// missingScopes returns the requested scopes that aren't in granted.
+func missingScopes(requested, granted []string) []string {
+	have := make(map[string]bool, len(granted))
+	for _, s := range granted {
+		have[normalizeScope(s)] = true
+	}
+	var missing []string
+	for _, s := range requested {
+		if !have[normalizeScope(s)] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,162 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestMissingScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []string
+		granted   []string
+		want      []string
+	}{
+		{name: "same", requested: []string{"email", "profile"}, granted: []string{"profile", "email"}},
+		{name: "superset granted", requested: []string{"email"}, granted: []string{"email", "profile"}},
+		{name: "subset granted", requested: []string{"email", "profile"}, granted: []string{"email"}, want: []string{"profile"}},
+		{name: "disjoint", requested: []string{"email", "profile"}, granted: []string{"openid"}, want: []string{"email", "profile"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingScopes(tt.requested, tt.granted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingScopes(%q, %q) = %q, want %q", tt.requested, tt.granted, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrantedScopes(t *testing.T) {
+	if got := GrantedScopes(&oauth2.Token{AccessToken: "at"}); got != nil {
+		t.Errorf("GrantedScopes(token without scope) = %q, want nil", got)
+	}
+	if got := GrantedScopes(withScopes(&oauth2.Token{}, nil)); got == nil || len(got) != 0 {
+		t.Errorf("GrantedScopes(token with no scopes) = %#v, want empty but not nil", got)
+	}
+	if got, want := GrantedScopes(withScopes(&oauth2.Token{}, []string{"email", "profile"})), []string{"email", "profile"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GrantedScopes() = %q, want %q", got, want)
+	}
+}
+
+func TestCachedTokenScopes(t *testing.T) {
+	tests := []struct {
+		name          string
+		granted       []string // nil for a token without a scope field
+		wantAuthorize bool
+	}{
+		{name: "superset granted", granted: []string{"email", "profile"}},
+		{name: "subset granted", granted: []string{"profile"}, wantAuthorize: true},
+		{name: "disjoint", granted: []string{"openid"}, wantAuthorize: true},
+		{name: "no scope field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTokenServer(t)
+			store := &MemoryTokenStore{}
+			cached := &oauth2.Token{AccessToken: "cached", Expiry: time.Now().Add(time.Hour)}
+			if tt.granted != nil {
+				cached = withScopes(cached, tt.granted)
+			}
+			store.Save(context.Background(), cached)
+
+			token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), "", []string{"email", "profile"},
+				WithTokenStore(store), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")))
+			if err != nil {
+				t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+			}
+			authorized := srv.requests("authorization_code") == 1
+			if authorized != tt.wantAuthorize {
+				t.Errorf("authorized = %v, want %v", authorized, tt.wantAuthorize)
+			}
+			if want := map[bool]string{false: "cached", true: "at"}[tt.wantAuthorize]; token.AccessToken != want {
+				t.Errorf("AccessToken = %q, want %q", token.AccessToken, want)
+			}
+		})
+	}
+}
+
+func TestCleanScopes(t *testing.T) {
+	got, err := cleanScopes([]string{" profile", "https://www.googleapis.com/auth/drive", "email ", "profile", "openid", "https://www.googleapis.com/auth/drive"})
+	if err != nil {
+		t.Fatalf("cleanScopes() error = %v", err)
+	}
+	if want := []string{"email", "https://www.googleapis.com/auth/drive", "openid", "profile"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cleanScopes() = %q, want %q", got, want)
+	}
+}
+
+func TestCleanScopesInvalid(t *testing.T) {
+	for _, scope := range []string{"", "  ", "drive", "www.googleapis.com/auth/drive", "https://www.googleapis.com/auth/drive email"} {
+		if _, err := cleanScopes([]string{"email", scope}); !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("cleanScopes(%q) error = %v, want %v", scope, err, ErrInvalidScope)
+		}
+	}
+}
+
+// The order and duplicates of the scopes don't change the config.
+func TestNewConfigCleansScopes(t *testing.T) {
+	config, err := NewConfigFromJSON(installedCredential("client"), []string{"profile", "email", "profile"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"email", "profile"}; !reflect.DeepEqual(config.Scopes, want) {
+		t.Errorf("Scopes = %q, want %q", config.Scopes, want)
+	}
+	if _, err := NewConfigFromJSON(installedCredential("client"), []string{"email", ""}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("NewConfigFromJSON() with an empty scope error = %v, want %v", err, ErrInvalidScope)
+	}
+}
+
+func TestScopesFromFile(t *testing.T) {
+	const drive = "https://www.googleapis.com/auth/drive"
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{name: "lines", data: "email\n" + drive + "\nprofile\n", want: []string{"email", drive, "profile"}},
+		{name: "commas", data: "profile, email ," + drive, want: []string{"email", drive, "profile"}},
+		{name: "mixed", data: "email,profile\r\n\n" + drive + "\n", want: []string{"email", drive, "profile"}},
+		{name: "comments", data: "# Scopes of the tool\nemail\n  # profile\n" + drive + "\n", want: []string{"email", drive}},
+		{name: "duplicates", data: "email\nemail, profile\nprofile\n", want: []string{"email", "profile"}},
+		{name: "empty", data: "# nothing\n\n", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scopes.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ScopesFromFile(path)
+			if err != nil {
+				t.Fatalf("ScopesFromFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ScopesFromFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopesFromFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ScopesFromFile(filepath.Join(dir, "missing.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ScopesFromFile() of a missing file error = %v, want a not-exist error", err)
+	}
+	path := filepath.Join(dir, "scopes.txt")
+	if err := os.WriteFile(path, []byte("email\ndrive\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScopesFromFile(path); !errors.Is(err, ErrInvalidScope) || !strings.Contains(err.Error(), path) {
+		t.Errorf("ScopesFromFile() error = %v, want %v naming the file", err, ErrInvalidScope)
+	}
+}
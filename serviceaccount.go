@@ -0,0 +1,59 @@
+package gclientauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
+)
+
+// serviceAccountType is the type of service account key files.
+const serviceAccountType = "service_account"
+
+// isServiceAccount returns whether the credential JSON is a service account
+// key rather than an OAuth client secret.
+func isServiceAccount(data []byte) bool {
+	var cred struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(data, &cred) == nil && cred.Type == serviceAccountType
+}
+
+// GetServiceAccountToken returns an access token and the JWT config for the
+// service account key file.  The token is obtained with the two-legged flow so
+// the user doesn't have to do anything.  Use WithSubject to impersonate a user
+// with domain-wide delegation.
+func GetServiceAccountToken(ctx context.Context, credential string, scopes []string, opts ...Option) (*oauth2.Token, *jwt.Config, error) {
+	o := newOptions(opts...)
+	ctx = o.context(ctx)
+
+	data, err := readCredential(credential, o.credentialEnv, "service account")
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isServiceAccount(data) {
+		return nil, nil, withSentinel(ErrInvalidCredential, "%v is not a service account file", credential)
+	}
+
+	scopes, err = cleanScopes(scopes)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := google.JWTConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, nil, withSentinel(ErrInvalidCredential, "error parsing service account file. %w", err)
+	}
+	config.Subject = o.subject
+	if o.endpoint != nil {
+		config.TokenURL = o.endpoint.TokenURL
+	}
+
+	token, err := config.TokenSource(ctx).Token()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get valid token for service account. %w", err)
+	}
+	return token, config, nil
+}
@@ -0,0 +1,82 @@
+package gclientauth
+
+import (
+	"encoding/json"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Status describes whether a token can be used and for how long.
+type Status struct {
+	// Valid is whether the token has an access token that hasn't expired.
+	Valid bool
+	// Expiry is when the access token expires, zero if it doesn't.
+	Expiry time.Time
+	// TimeRemaining is how long the access token is still valid, zero if it
+	// has expired or doesn't expire.
+	TimeRemaining time.Duration
+	// HasRefreshToken is whether the token can be refreshed without the
+	// user.
+	HasRefreshToken bool
+}
+
+// TokenStatus returns the status of the token without refreshing it, e.g. to
+// show the user how long they stay signed in.  A token that expires within
+// the expiry delta isn't valid, like everywhere else in the package, and
+// neither is a nil token.  Only WithClock and WithExpiryDelta of the options
+// are used.
+func TokenStatus(token *oauth2.Token, opts ...Option) Status {
+	if token == nil {
+		return Status{}
+	}
+	o := newOptions(opts...)
+	now := o.now()
+	s := Status{
+		Valid:           o.valid(token),
+		Expiry:          token.Expiry,
+		HasRefreshToken: token.RefreshToken != "",
+	}
+	if !token.Expiry.IsZero() {
+		if d := token.Expiry.Sub(now); d > 0 {
+			s.TimeRemaining = d
+		}
+	}
+	return s
+}
+
+// jsonStatus is the JSON document of StatusJSON.
+type jsonStatus struct {
+	Valid            bool     `json:"valid"`
+	Expiry           string   `json:"expiry,omitempty"`
+	RemainingSeconds int64    `json:"remaining_seconds"`
+	HasRefreshToken  bool     `json:"has_refresh_token"`
+	GrantedScopes    []string `json:"granted_scopes"`
+	MissingScopes    []string `json:"missing_scopes"`
+}
+
+// StatusJSON returns the TokenStatus of the token as JSON for scripts, along
+// with its granted scopes and which of scopes it lacks.  The expiry is in
+// RFC 3339 format and omitted if the token doesn't expire.  The token's secrets
+// aren't included.  Scopes are only reported missing if the granted scopes are
+// known.  Only WithClock and WithExpiryDelta of the options are used.
+func StatusJSON(token *oauth2.Token, scopes []string, opts ...Option) ([]byte, error) {
+	s := TokenStatus(token, opts...)
+	js := jsonStatus{
+		Valid:            s.Valid,
+		RemainingSeconds: int64(s.TimeRemaining / time.Second),
+		HasRefreshToken:  s.HasRefreshToken,
+		GrantedScopes:    []string{},
+		MissingScopes:    []string{},
+	}
+	if !s.Expiry.IsZero() {
+		js.Expiry = s.Expiry.UTC().Format(time.RFC3339)
+	}
+	if granted := GrantedScopes(token); granted != nil {
+		js.GrantedScopes = granted
+		if missing := missingScopes(scopes, granted); missing != nil {
+			js.MissingScopes = missing
+		}
+	}
+	return json.Marshal(js)
+}
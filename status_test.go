@@ -0,0 +1,124 @@
+package gclientauth
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenStatus(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := WithClock(func() time.Time { return now })
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+		opts  []Option
+		want  Status
+	}{
+		{name: "nil", want: Status{}},
+		{
+			name:  "expired",
+			token: &oauth2.Token{AccessToken: "at", RefreshToken: "rt", Expiry: now.Add(-time.Minute)},
+			want:  Status{Expiry: now.Add(-time.Minute), HasRefreshToken: true},
+		},
+		{
+			// The token is refreshed before it is used, so it isn't valid.
+			name:  "expires within the expiry delta",
+			token: &oauth2.Token{AccessToken: "at", Expiry: now.Add(20 * time.Second)},
+			want:  Status{Expiry: now.Add(20 * time.Second), TimeRemaining: 20 * time.Second},
+		},
+		{
+			name:  "expires after WithExpiryDelta",
+			token: &oauth2.Token{AccessToken: "at", Expiry: now.Add(20 * time.Second)},
+			opts:  []Option{WithExpiryDelta(10 * time.Second)},
+			want:  Status{Valid: true, Expiry: now.Add(20 * time.Second), TimeRemaining: 20 * time.Second},
+		},
+		{
+			name:  "long-lived",
+			token: &oauth2.Token{AccessToken: "at", RefreshToken: "rt", Expiry: now.Add(42 * time.Minute)},
+			want:  Status{Valid: true, Expiry: now.Add(42 * time.Minute), TimeRemaining: 42 * time.Minute, HasRefreshToken: true},
+		},
+		{
+			name:  "doesn't expire",
+			token: &oauth2.Token{AccessToken: "at"},
+			want:  Status{Valid: true},
+		},
+		{
+			name:  "no access token",
+			token: &oauth2.Token{RefreshToken: "rt", Expiry: now.Add(time.Hour)},
+			want:  Status{Expiry: now.Add(time.Hour), TimeRemaining: time.Hour, HasRefreshToken: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TokenStatus(tt.token, append([]Option{clock}, tt.opts...)...); got != tt.want {
+				t.Errorf("TokenStatus() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The status agrees with whether the token would be refreshed.
+func TestTokenStatusMatchesValid(t *testing.T) {
+	now := time.Now()
+	for _, d := range []time.Duration{-time.Minute, 0, 15 * time.Second, 30 * time.Second, 31 * time.Second, time.Hour} {
+		token := &oauth2.Token{AccessToken: "at", Expiry: now.Add(d)}
+		o := newOptions(WithClock(func() time.Time { return now }))
+		if got, want := TokenStatus(token, WithClock(func() time.Time { return now })).Valid, o.valid(token); got != want {
+			t.Errorf("TokenStatus(expiry in %v).Valid = %v, want %v", d, got, want)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// golden compares got with the golden file testdata/name, or updates the file
+// with -update.
+func golden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n%s\nwant the golden file %v\n%s", got, path, want)
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := WithClock(func() time.Time { return now })
+	token := withScopes(&oauth2.Token{AccessToken: "secret-access", RefreshToken: "secret-refresh", Expiry: now.Add(42 * time.Minute)},
+		[]string{"email", "https://www.googleapis.com/auth/drive"})
+	tests := []struct {
+		name   string
+		token  *oauth2.Token
+		scopes []string
+	}{
+		{name: "status.golden", token: token, scopes: []string{"email", "profile"}},
+		{name: "status_nil.golden", scopes: []string{"email"}},
+		{name: "status_no_expiry.golden", token: &oauth2.Token{AccessToken: "secret-access"}, scopes: []string{"email"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StatusJSON(tt.token, tt.scopes, clock)
+			if err != nil {
+				t.Fatalf("StatusJSON() error = %v", err)
+			}
+			if bytes.Contains(got, []byte("secret")) {
+				t.Errorf("StatusJSON() = %s, contains a secret of the token", got)
+			}
+			golden(t, tt.name, append(got, '\n'))
+		})
+	}
+}
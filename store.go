@@ -0,0 +1,240 @@
+package gclientauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenStore loads and saves the token so the user doesn't have to authorize
+// the application every time it runs.
+type TokenStore interface {
+	// Load returns the stored token or an error if there isn't one.
+	Load(ctx context.Context) (*oauth2.Token, error)
+	// Save stores the token, replacing any previously stored token.
+	Save(ctx context.Context, token *oauth2.Token) error
+}
+
+// defaultTokenFileMode is the permission of token files so other users can't
+// read the refresh token.
+const defaultTokenFileMode os.FileMode = 0600
+
+// FileTokenStore is a TokenStore that keeps the token as JSON in the file at
+// Path.  It is the default TokenStore.
+type FileTokenStore struct {
+	Path string
+	// Mode is the permission of the token file.  Defaults to 0600.
+	Mode os.FileMode
+}
+
+// Load reads the token from the file.
+func (s FileTokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	data, err := readTokenFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	token, migrated, err := decodeToken(data)
+	if err != nil {
+		return nil, decodeError(fmt.Sprintf("token file (%v)", s.Path), err)
+	}
+	if migrated {
+		// The token can still be used if it can't be rewritten, e.g. if
+		// the file is read-only.
+		s.Save(ctx, token)
+	}
+	return token, nil
+}
+
+// Save writes the token to the file.  The file is replaced atomically so a
+// failed write never clobbers the previously saved token.
+func (s FileTokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	data, err := encodeToken(token)
+	if err != nil {
+		return fmt.Errorf("unable to encode the token. %w", err)
+	}
+	mode := s.Mode
+	if mode == 0 {
+		mode = defaultTokenFileMode
+	}
+	if err := writeFileAtomic(s.Path, data, mode); err != nil {
+		return fmt.Errorf("unable to write token file (%v). %w", s.Path, err)
+	}
+	return nil
+}
+
+// Delete removes the token file.  It isn't an error if there is no file.
+func (s FileTokenStore) Delete(ctx context.Context) error {
+	return removeTokenFile(s.Path)
+}
+
+// DeleteCachedToken removes the cached token file at path, e.g. to log the
+// user out after revoking the token with RevokeToken.  It isn't an error if
+// the file doesn't exist.
+func DeleteCachedToken(path string) error {
+	return removeTokenFile(path)
+}
+
+// removeTokenFile removes the token file at path, ignoring a missing file.
+func removeTokenFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to delete token file (%v). %w", path, err)
+	}
+	return nil
+}
+
+// cacheVersion is the version of the format tokens are persisted in.  Tokens
+// persisted in an older format are upgraded by cacheMigrations when they are
+// loaded.
+const cacheVersion = 1
+
+// cacheMigrations upgrade persisted tokens from the version at their index to
+// the next version.
+var cacheMigrations = []func(data []byte) ([]byte, error){
+	migrateUnversioned,
+}
+
+// storedToken is how tokens are persisted.  It keeps the granted scopes, grant
+// time and clientHash, which oauth2.Token doesn't marshal, along with the
+// token.
+type storedToken struct {
+	Version    int           `json:"version"`
+	Token      *oauth2.Token `json:"token"`
+	Scopes     []string      `json:"scopes,omitempty"`
+	GrantedAt  *time.Time    `json:"granted_at,omitempty"`
+	ClientHash string        `json:"client_hash,omitempty"`
+}
+
+// bareToken is how tokens were persisted before storedToken: the token's own
+// JSON, optionally with the granted scopes.
+type bareToken struct {
+	*oauth2.Token
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// encodeToken returns the JSON of the token and its grant.
+func encodeToken(token *oauth2.Token) ([]byte, error) {
+	st := storedToken{Version: cacheVersion, Token: token, Scopes: GrantedScopes(token), ClientHash: tokenClientHash(token)}
+	if t := grantedAt(token); !t.IsZero() {
+		st.GrantedAt = &t
+	}
+	return json.Marshal(st)
+}
+
+// migrateUnversioned upgrades tokens persisted before the format had a version
+// (version 0): the bare token JSON, optionally with the granted scopes, and
+// storedToken without its version.
+func migrateUnversioned(data []byte) ([]byte, error) {
+	var st storedToken
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	if st.Token == nil {
+		var bt bareToken
+		if err := json.Unmarshal(data, &bt); err != nil {
+			return nil, err
+		}
+		st.Token, st.Scopes = bt.Token, bt.Scopes
+	}
+	if st.Token == nil {
+		// Nothing is rewritten without a token.
+		return nil, errNoStoredToken
+	}
+	st.Version = 1
+	return json.Marshal(st)
+}
+
+// decodeToken returns the token from the JSON written by encodeToken of this
+// or an older version of the package, and whether it was upgraded from an
+// older format so it can be persisted in the current one.  ErrCacheVersion is
+// returned for formats of newer versions and errNoStoredToken if the JSON has
+// no token.
+func decodeToken(data []byte) (token *oauth2.Token, migrated bool, err error) {
+	var v struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, false, err
+	}
+	if v.Version > cacheVersion || v.Version < 0 {
+		return nil, false, withSentinel(ErrCacheVersion, "format version %v isn't supported, only up to %v", v.Version, cacheVersion)
+	}
+	for ; v.Version < cacheVersion; v.Version++ {
+		if data, err = cacheMigrations[v.Version](data); err != nil {
+			return nil, false, fmt.Errorf("unable to upgrade format version %v. %w", v.Version, err)
+		}
+		migrated = true
+	}
+
+	var st storedToken
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, false, err
+	}
+	if st.Token == nil {
+		return nil, false, errNoStoredToken
+	}
+	token = st.Token
+	if token != nil && len(st.Scopes) > 0 {
+		token = withScopes(token, st.Scopes)
+	}
+	if token != nil && st.GrantedAt != nil {
+		token = withExtra(token, grantedAtKey, *st.GrantedAt)
+	}
+	if token != nil && st.ClientHash != "" {
+		token = withExtra(token, clientHashKey, st.ClientHash)
+	}
+	return token, migrated, nil
+}
+
+// decodeError returns the error of a token store for the error of decodeToken
+// decoding the token stored at where.
+func decodeError(where string, err error) error {
+	if errors.Is(err, ErrCacheVersion) {
+		return fmt.Errorf("unable to decode %v. %w", where, err)
+	}
+	return withSentinel(ErrCorruptCache, "unable to decode %v. %w", where, err)
+}
+
+// readTokenFile returns the contents of the token file at path.
+func readTokenFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token file (%v). %w", path, err)
+	}
+	return data, nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// path and renames it to path once it is completely written.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
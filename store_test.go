@@ -0,0 +1,527 @@
+package gclientauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestFileTokenStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := FileTokenStore{Path: cachePath(t)}
+	want := &oauth2.Token{AccessToken: "at", TokenType: "Bearer", RefreshToken: "rt", Expiry: time.Now().Add(time.Hour).Round(time.Second)}
+	if err := store.Save(ctx, want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got.AccessToken != want.AccessToken || got.RefreshToken != want.RefreshToken || !got.Expiry.Equal(want.Expiry) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFileTokenStoreLoadMissing(t *testing.T) {
+	if _, err := (FileTokenStore{Path: cachePath(t)}).Load(context.Background()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load() error = %v, want a not-exist error", err)
+	}
+}
+
+func TestWithTokenStore(t *testing.T) {
+	ctx := context.Background()
+	store := &MemoryTokenStore{}
+	cached := withScopes(&oauth2.Token{AccessToken: "cached", Expiry: time.Now().Add(time.Hour)}, []string{"email"})
+	if err := store.Save(ctx, cached); err != nil {
+		t.Fatal(err)
+	}
+	path := cachePath(t)
+
+	token, _, err := GetGoogleOauth2TokenFromJSON(ctx, installedCredential("client"), path, []string{"email"}, WithTokenStore(store))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if token.AccessToken != "cached" {
+		t.Errorf("AccessToken = %q, want the token of the store", token.AccessToken)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the cachedtoken file was used instead of the store: %v", err)
+	}
+}
+
+func TestDefaultTokenStoreIsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	store, err := newOptions().tokenStore(path, &oauth2.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs, ok := store.(FileTokenStore); !ok || fs.Path != path {
+		t.Errorf("tokenStore() = %#v, want FileTokenStore{Path: %q}", store, path)
+	}
+}
+
+func TestFileTokenStorePermissions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want os.FileMode
+	}{
+		{name: "default", want: 0600},
+		{name: "WithTokenFileMode", opts: []Option{WithTokenFileMode(0640)}, want: 0640},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := cachePath(t)
+			store, err := newOptions(tt.opts...).tokenStore(path, &oauth2.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(context.Background(), &oauth2.Token{AccessToken: "at"}); err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fi.Mode().Perm(); got != tt.want {
+				t.Errorf("mode = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileTokenStoreSaveIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	store := FileTokenStore{Path: cachePath(t)}
+	if err := store.Save(ctx, &oauth2.Token{AccessToken: "old"}); err != nil {
+		t.Fatal(err)
+	}
+	// A write in place would also change the file through the hard link.
+	old := filepath.Join(filepath.Dir(store.Path), "old.json")
+	if err := os.Link(store.Path, old); err != nil {
+		t.Skipf("hard links aren't supported: %v", err)
+	}
+	// The temporary file of a write that was interrupted is ignored.
+	if err := os.WriteFile(store.Path+".123.tmp", []byte(`{"access_tok`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, &oauth2.Token{AccessToken: "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := (FileTokenStore{Path: old}).Load(ctx); err != nil || token.AccessToken != "old" {
+		t.Errorf("previous token file = %+v, %v, want it untouched", token, err)
+	}
+	if token, err := store.Load(ctx); err != nil || token.AccessToken != "new" {
+		t.Errorf("Load() = %+v, %v, want the new token", token, err)
+	}
+}
+
+// readOnlyStore is a MemoryTokenStore whose Save fails.
+type readOnlyStore struct {
+	MemoryTokenStore
+}
+
+func (s *readOnlyStore) Save(ctx context.Context, token *oauth2.Token) error {
+	return errors.New("read-only store")
+}
+
+func TestSaveFailureIsLogged(t *testing.T) {
+	srv := newTokenServer(t)
+	store := &readOnlyStore{}
+	expired := withScopes(&oauth2.Token{AccessToken: "expired", RefreshToken: "rt", Expiry: time.Now().Add(-time.Hour)}, []string{"email"})
+	store.MemoryTokenStore.Save(context.Background(), expired)
+	logger := &recordingLogger{}
+
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), "", []string{"email"},
+		WithTokenStore(store), WithEndpoint(srv.endpoint()), WithLogger(logger), WithPromptWriter(io.Discard))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want the token even though it can't be saved", err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want the refreshed token", token.AccessToken)
+	}
+	if !logger.contains("(WARNING) Unable to write token to local cache. read-only store") {
+		t.Errorf("logged %q, want the warning about the cache", logger.lines)
+	}
+}
+
+func TestFileTokenStoreKeepsGrant(t *testing.T) {
+	ctx := context.Background()
+	store := FileTokenStore{Path: cachePath(t)}
+	granted := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	token := withExtra(withScopes(&oauth2.Token{AccessToken: "at"}, []string{"email", "profile"}), grantedAtKey, granted)
+	if err := store.Save(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored storedToken
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Scopes, []string{"email", "profile"}) || stored.GrantedAt == nil || !stored.GrantedAt.Equal(granted) {
+		t.Errorf("stored scopes = %q, granted_at = %v, want the grant of the token", stored.Scopes, stored.GrantedAt)
+	}
+
+	got, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scopes := GrantedScopes(got); !reflect.DeepEqual(scopes, []string{"email", "profile"}) {
+		t.Errorf("GrantedScopes(loaded token) = %q", scopes)
+	}
+	if at := grantedAt(got); !at.Equal(granted) {
+		t.Errorf("grantedAt(loaded token) = %v, want %v", at, granted)
+	}
+}
+
+func TestFileTokenStoreLoadsBareToken(t *testing.T) {
+	store := FileTokenStore{Path: cachePath(t)}
+	if err := os.WriteFile(store.Path, []byte(`{"access_token":"at","token_type":"Bearer","refresh_token":"rt","expiry":"2020-01-01T00:00:00Z"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if token.AccessToken != "at" || token.RefreshToken != "rt" {
+		t.Errorf("Load() = %+v, want the bare token", token)
+	}
+	if scopes := GrantedScopes(token); scopes != nil {
+		t.Errorf("GrantedScopes() = %q, want nil for a token saved without scopes", scopes)
+	}
+}
+
+func TestCorruptCacheIsReplaced(t *testing.T) {
+	srv := newTokenServer(t)
+	path := cachePath(t)
+	if err := os.WriteFile(path, []byte("\x00garbage{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	logger := &recordingLogger{}
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), path, []string{"email"},
+		WithEndpoint(srv.endpoint()), WithLogger(logger), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if !logger.contains("(WARNING) Cached token is corrupt") {
+		t.Errorf("logged %q, want a warning about the corrupt cache", logger.lines)
+	}
+	saved, err := (FileTokenStore{Path: path}).Load(context.Background())
+	if err != nil {
+		t.Fatalf("the cache wasn't replaced: %v", err)
+	}
+	if saved.AccessToken != token.AccessToken {
+		t.Errorf("cached token = %q, want %q", saved.AccessToken, token.AccessToken)
+	}
+}
+
+func TestCorruptCacheError(t *testing.T) {
+	for _, data := range []string{"{", `{"version":1,"token":"x"}`} {
+		path := cachePath(t)
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (FileTokenStore{Path: path}).Load(context.Background()); !errors.Is(err, ErrCorruptCache) {
+			t.Errorf("Load(%q) error = %v, want %v", data, err, ErrCorruptCache)
+		}
+	}
+}
+
+func TestFileTokenStoreDelete(t *testing.T) {
+	ctx := context.Background()
+	store := FileTokenStore{Path: cachePath(t)}
+	if err := store.Save(ctx, &oauth2.Token{AccessToken: "at"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(store.Path); !os.IsNotExist(err) {
+		t.Errorf("the token file still exists: %v", err)
+	}
+	if err := store.Delete(ctx); err != nil {
+		t.Errorf("Delete() of a missing file error = %v, want nil", err)
+	}
+}
+
+func TestDeleteCachedToken(t *testing.T) {
+	path := cachePath(t)
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteCachedToken(path); err != nil {
+		t.Fatalf("DeleteCachedToken() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the token file still exists: %v", err)
+	}
+	if err := DeleteCachedToken(path); err != nil {
+		t.Errorf("DeleteCachedToken() of a missing file error = %v, want nil", err)
+	}
+	// Other errors than a missing file are reported.
+	dir := filepath.Join(t.TempDir(), "dir")
+	if err := os.MkdirAll(filepath.Join(dir, "child"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteCachedToken(dir); err == nil {
+		t.Error("DeleteCachedToken() of a non-empty directory error = nil")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.json")
+	for _, data := range []string{`{"a":1}`, `{"b":2}`} {
+		if err := writeFileAtomic(path, []byte(data), 0600); err != nil {
+			t.Fatalf("writeFileAtomic() error = %v", err)
+		}
+		got, err := readTokenFile(path)
+		if err != nil {
+			t.Fatalf("readTokenFile() error = %v", err)
+		}
+		if string(got) != data {
+			t.Errorf("readTokenFile() = %q, want %q", got, data)
+		}
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d files in the directory, want no temporary files left", len(files))
+	}
+}
+
+func TestWriteFileAtomicFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "token.json")
+	if err := writeFileAtomic(path, []byte("{}"), 0600); err == nil {
+		t.Error("writeFileAtomic() to a missing directory error = nil")
+	}
+	if _, err := readTokenFile(path); !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), path) {
+		t.Errorf("readTokenFile() error = %v, want a not-exist error naming the file", err)
+	}
+}
+
+// Tokens saved in the current format and tokens cached by earlier versions are
+// read back the same.
+func TestFileTokenStoreReadsAllFormats(t *testing.T) {
+	ctx := context.Background()
+	expiry := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := &oauth2.Token{AccessToken: "at", TokenType: "Bearer", RefreshToken: "rt", Expiry: expiry}
+	current := FileTokenStore{Path: cachePath(t)}
+	if err := current.Save(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	old := FileTokenStore{Path: cachePath(t)}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(old.Path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]FileTokenStore{"current": current, "old": old} {
+		got, err := store.Load(ctx)
+		if err != nil {
+			t.Fatalf("%v: Load() error = %v", name, err)
+		}
+		if got.AccessToken != want.AccessToken || got.TokenType != want.TokenType || got.RefreshToken != want.RefreshToken || !got.Expiry.Equal(want.Expiry) {
+			t.Errorf("%v: Load() = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+// cachedVersion returns the format version of the token persisted in data.
+func cachedVersion(t *testing.T, data []byte) int {
+	var v struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("persisted token %q: %v", data, err)
+	}
+	if v.Version == nil {
+		return 0
+	}
+	return *v.Version
+}
+
+func TestMigrateUnversioned(t *testing.T) {
+	granted := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		data    string
+		scopes  []string
+		granted time.Time
+	}{
+		{name: "bare token", data: `{"access_token":"at","token_type":"Bearer","refresh_token":"rt","expiry":"2030-01-01T00:00:00Z"}`},
+		{name: "bare token with scopes", data: `{"access_token":"at","refresh_token":"rt","expiry":"2030-01-01T00:00:00Z","scopes":["email","openid"]}`, scopes: []string{"email", "openid"}},
+		{name: "stored token", data: `{"token":{"access_token":"at","refresh_token":"rt","expiry":"2030-01-01T00:00:00Z"},"scopes":["email"],"granted_at":"2020-01-01T00:00:00Z"}`, scopes: []string{"email"}, granted: granted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := migrateUnversioned([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("migrateUnversioned() error = %v", err)
+			}
+			if v := cachedVersion(t, data); v != 1 {
+				t.Errorf("migrateUnversioned() = %s with version %v, want version 1", data, v)
+			}
+			token, migrated, err := decodeToken(data)
+			if err != nil || migrated {
+				t.Fatalf("decodeToken(migrated) = %v, %v, want the token without another migration", migrated, err)
+			}
+			if token.AccessToken != "at" || token.RefreshToken != "rt" || !token.Expiry.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("migrated token = %+v, want the token of %s", token, tt.data)
+			}
+			if got := GrantedScopes(token); !reflect.DeepEqual(got, tt.scopes) {
+				t.Errorf("GrantedScopes(migrated token) = %q, want %q", got, tt.scopes)
+			}
+			if got := grantedAt(token); !got.Equal(tt.granted) {
+				t.Errorf("grantedAt(migrated token) = %v, want %v", got, tt.granted)
+			}
+		})
+	}
+}
+
+func TestDecodeTokenVersion(t *testing.T) {
+	current, err := encodeToken(&oauth2.Token{AccessToken: "at"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := cachedVersion(t, current); v != cacheVersion {
+		t.Errorf("encodeToken() version = %v, want %v", v, cacheVersion)
+	}
+	tests := []struct {
+		name     string
+		data     string
+		migrated bool
+		err      error
+	}{
+		{name: "current", data: string(current)},
+		{name: "unversioned", data: `{"access_token":"at"}`, migrated: true},
+		{name: "version 0", data: `{"version":0,"token":{"access_token":"at"}}`, migrated: true},
+		{name: "newer", data: `{"version":2,"token":{"access_token":"at"},"fingerprint":"x"}`, err: ErrCacheVersion},
+		{name: "negative", data: `{"version":-1,"token":{"access_token":"at"}}`, err: ErrCacheVersion},
+		{name: "empty", data: "{}", err: errNoStoredToken},
+		{name: "null", data: "null", err: errNoStoredToken},
+		{name: "unversioned scopes only", data: `{"scopes":["email"]}`, err: errNoStoredToken},
+		{name: "version only", data: `{"version":1}`, err: errNoStoredToken},
+		{name: "null token", data: `{"version":1,"token":null}`, err: errNoStoredToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, migrated, err := decodeToken([]byte(tt.data))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) || token != nil {
+					t.Errorf("decodeToken() = %v, %v, want %v", token, err, tt.err)
+				}
+				return
+			}
+			if err != nil || token.AccessToken != "at" || migrated != tt.migrated {
+				t.Errorf("decodeToken() = %+v, %v, %v, want the token, %v", token, migrated, err, tt.migrated)
+			}
+		})
+	}
+
+	// Nothing is upgraded without a token.
+	for _, data := range []string{"{}", "null", `{"version":0}`, `{"scopes":["email"]}`} {
+		if upgraded, err := migrateUnversioned([]byte(data)); !errors.Is(err, errNoStoredToken) {
+			t.Errorf("migrateUnversioned(%s) = %s, %v, want %v", data, upgraded, err, errNoStoredToken)
+		}
+	}
+
+	// A token that can't be upgraded is corrupt rather than of a newer format.
+	if _, _, err := decodeToken([]byte(`{"version":0,"token":"x"}`)); err == nil || errors.Is(err, ErrCacheVersion) || !strings.Contains(err.Error(), "unable to upgrade format version 0") {
+		t.Errorf("decodeToken() of a broken version 0 token error = %v, want the migration failure", err)
+	}
+}
+
+// Files of older versions are rewritten in the current format when loaded.
+func TestFileTokenStoreUpgradesOnLoad(t *testing.T) {
+	ctx := context.Background()
+	store := FileTokenStore{Path: cachePath(t)}
+	if err := os.WriteFile(store.Path, []byte(`{"access_token":"at","refresh_token":"rt","scopes":["email"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	data, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := cachedVersion(t, data); v != cacheVersion {
+		t.Errorf("token file after Load() = %s, want version %v", data, cacheVersion)
+	}
+	again, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() of the upgraded file error = %v", err)
+	}
+	if again.AccessToken != token.AccessToken || again.RefreshToken != token.RefreshToken || !reflect.DeepEqual(GrantedScopes(again), []string{"email"}) {
+		t.Errorf("Load() of the upgraded file = %+v, want %+v with its scopes", again, token)
+	}
+}
+
+// Tokens saved by newer versions aren't misread but replaced after
+// authorization.
+func TestNewerCacheVersionIsReplaced(t *testing.T) {
+	srv := newTokenServer(t)
+	path := cachePath(t)
+	if err := os.WriteFile(path, []byte(`{"version":99,"token":{"access_token":"newer"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (FileTokenStore{Path: path}).Load(context.Background()); !errors.Is(err, ErrCacheVersion) || errors.Is(err, ErrCorruptCache) {
+		t.Errorf("Load() error = %v, want %v", err, ErrCacheVersion)
+	}
+	logger := &recordingLogger{}
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), path, []string{"email"},
+		WithEndpoint(srv.endpoint()), WithLogger(logger), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if token.AccessToken == "newer" || !logger.contains("(WARNING) Cached token was saved by a newer version") {
+		t.Errorf("AccessToken = %q, logged %q, want a new token and a warning about the format", token.AccessToken, logger.lines)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := cachedVersion(t, data); v != cacheVersion {
+		t.Errorf("token file = %s, want it replaced in version %v", data, cacheVersion)
+	}
+}
+
+// Stores report persisted JSON without a token as corrupt and leave it alone
+// instead of loading a nil token.
+func TestNoStoredTokenIsCorrupt(t *testing.T) {
+	ctx := context.Background()
+	for _, data := range []string{"{}", "null", `{"version":1}`, `{"version":1,"token":null}`} {
+		store := FileTokenStore{Path: cachePath(t)}
+		if err := os.WriteFile(store.Path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if token, err := store.Load(ctx); !errors.Is(err, ErrCorruptCache) || token != nil {
+			t.Errorf("Load() of %s = %v, %v, want %v", data, token, err, ErrCorruptCache)
+		}
+		if got, err := os.ReadFile(store.Path); err != nil || string(got) != data {
+			t.Errorf("token file after Load() = %s, %v, want %s unchanged", got, err, data)
+		}
+		if err := Logout(ctx, store); !errors.Is(err, ErrCorruptCache) {
+			t.Errorf("Logout() of %s error = %v, want %v", data, err, ErrCorruptCache)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package gclientauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// googleTokenInfoURL is Google's endpoint describing access tokens.
+const googleTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// VerifyTokenScopes asks Google's tokeninfo endpoint which scopes the access
+// token was granted and returns ErrMissingScope if any of requiredScopes isn't
+// among them.  Unlike GrantedScopes, which reports what was recorded when the
+// token was saved, it can't be wrong about stale or hand-edited cache files.
+// The HTTP client set in ctx with oauth2.HTTPClient is used for the request.
+func VerifyTokenScopes(ctx context.Context, token *oauth2.Token, requiredScopes []string) error {
+	if token == nil || token.AccessToken == "" {
+		return errors.New("no access token to verify")
+	}
+	// The token is posted so it doesn't end up in the logs of proxies.
+	status, body, err := postForm(ctx, googleTokenInfoURL, url.Values{"access_token": {token.AccessToken}})
+	if err != nil {
+		return fmt.Errorf("unable to get token info. %w", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("unable to get token info (status %v). %s", status, body)
+	}
+	var info struct {
+		Scope string `json:"scope"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return fmt.Errorf("unable to decode token info. %w", err)
+	}
+	if missing := missingScopes(requiredScopes, strings.Fields(info.Scope)); len(missing) > 0 {
+		return withSentinel(ErrMissingScope, "token lacks the scopes %v", missing)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package gclientauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// newTokenInfoServer returns a fake tokeninfo endpoint that describes the access
+// token "at" as granted scope, and a context whose HTTP client sends the
+// requests for googleTokenInfoURL to it.  Other tokens are invalid.
+func newTokenInfoServer(t *testing.T, scope string) context.Context {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/tokeninfo" {
+			t.Errorf("request %v %v, want POST /tokeninfo", r.Method, r.URL.Path)
+		}
+		if r.URL.Query().Get("access_token") != "" {
+			t.Error("the access token is in the URL, want it in the body")
+		}
+		r.ParseForm()
+		switch r.PostForm.Get("access_token") {
+		case "at":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"azp":"client","aud":"client","scope":"`+scope+`","exp":"1600000000","expires_in":"3599","access_type":"offline"}`)
+		case "garbled":
+			io.WriteString(w, "<html>")
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_token","error_description":"Invalid Value"}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client := &http.Client{Transport: rewriteTo(t, srv)}
+	return context.WithValue(context.Background(), oauth2.HTTPClient, client)
+}
+
+func TestVerifyTokenScopes(t *testing.T) {
+	const granted = "https://www.googleapis.com/auth/userinfo.email openid https://www.googleapis.com/auth/drive.readonly"
+	ctx := newTokenInfoServer(t, granted)
+	token := &oauth2.Token{AccessToken: "at"}
+	tests := []struct {
+		name     string
+		required []string
+		missing  string
+	}{
+		{name: "all granted", required: []string{"https://www.googleapis.com/auth/drive.readonly", "openid"}},
+		{name: "aliases", required: []string{"email"}},
+		{name: "none required"},
+		{name: "missing", required: []string{"openid", "https://www.googleapis.com/auth/drive"}, missing: "https://www.googleapis.com/auth/drive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyTokenScopes(ctx, token, tt.required)
+			if tt.missing == "" {
+				if err != nil {
+					t.Errorf("VerifyTokenScopes() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrMissingScope) || !strings.Contains(err.Error(), tt.missing) {
+				t.Errorf("VerifyTokenScopes() error = %v, want %v naming %v", err, ErrMissingScope, tt.missing)
+			}
+		})
+	}
+}
+
+// The cached scopes aren't trusted over what Google reports.
+func TestVerifyTokenScopesStaleCache(t *testing.T) {
+	ctx := newTokenInfoServer(t, "openid")
+	token := withScopes(&oauth2.Token{AccessToken: "at"}, []string{"openid", "https://www.googleapis.com/auth/drive"})
+	if err := VerifyTokenScopes(ctx, token, []string{"https://www.googleapis.com/auth/drive"}); !errors.Is(err, ErrMissingScope) {
+		t.Errorf("VerifyTokenScopes() error = %v, want %v", err, ErrMissingScope)
+	}
+}
+
+func TestVerifyTokenScopesErrors(t *testing.T) {
+	ctx := newTokenInfoServer(t, "openid")
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+		want  string
+	}{
+		{name: "nil", want: "no access token"},
+		{name: "no access token", token: &oauth2.Token{RefreshToken: "rt"}, want: "no access token"},
+		{name: "invalid", token: &oauth2.Token{AccessToken: "expired"}, want: "status 400"},
+		{name: "not JSON", token: &oauth2.Token{AccessToken: "garbled"}, want: "unable to decode token info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyTokenScopes(ctx, tt.token, []string{"openid"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) || errors.Is(err, ErrMissingScope) {
+				t.Errorf("VerifyTokenScopes() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package gclientauth
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// refreshToken returns a new token obtained with the refresh token of token,
+// even if token is still valid.
+func refreshToken(ctx context.Context, config *oauth2.Config, token *oauth2.Token) (*oauth2.Token, error) {
+	// Without an access token the token source has to refresh it.
+	return config.TokenSource(ctx, &oauth2.Token{RefreshToken: token.RefreshToken}).Token()
+}
+
+// earlyTokenSource is like the token source of oauth2.Config except that it
+// refreshes tokens that expire within the expiry delta set with
+// WithExpiryDelta instead of the oauth2 package's fixed delta.
+type earlyTokenSource struct {
+	ctx    context.Context
+	config *oauth2.Config
+	o      *options
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// Token returns the current token if it is still valid or a refreshed one.
+func (s *earlyTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.o.valid(s.token) {
+		return s.token, nil
+	}
+	token, err := refreshToken(s.ctx, s.config, s.token)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// persistingTokenSource is an oauth2.TokenSource that saves every new token
+// returned by src to store so refreshed tokens are available to the next run.
+type persistingTokenSource struct {
+	ctx    context.Context
+	src    oauth2.TokenSource
+	store  TokenStore
+	logger Logger
+
+	mu   sync.Mutex
+	last *oauth2.Token // last saved token
+}
+
+// newPersistingTokenSource returns a token source that saves the tokens from
+// src to store.  saved is the token that is already in the store.
+func newPersistingTokenSource(ctx context.Context, src oauth2.TokenSource, store TokenStore, saved *oauth2.Token, logger Logger) *persistingTokenSource {
+	return &persistingTokenSource{ctx: ctx, src: src, store: store, logger: logger, last: saved}
+}
+
+// Token returns the token from the underlying source, saving it first if it
+// has changed since the last save.
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil || token.AccessToken != s.last.AccessToken {
+		// Refreshed tokens may not report their scopes but they keep
+		// the grant of the token they were refreshed from.
+		saved := token
+		if s.last != nil {
+			saved = inheritGrant(token, s.last)
+		}
+		// The token is still usable even if it can't be saved so the
+		// error isn't returned and saving is tried again next time.
+		if err := s.store.Save(s.ctx, saved); err != nil {
+			s.logger.Printf("(WARNING) Unable to write token to local cache. %v", err)
+		} else {
+			s.last = saved
+		}
+	}
+	return token, nil
+}
+
+// GetTokenSource returns a token source for the token from
+// GetGoogleOauth2Token that refreshes the token when it expires and saves the
+// refreshed token back to the cachedtoken file (or the TokenStore set with
+// WithTokenStore).
+func GetTokenSource(ctx context.Context, credential, cachedtoken string, scopes []string, opts ...Option) (oauth2.TokenSource, error) {
+	r, err := Authenticate(ctx, credential, cachedtoken, scopes, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return r.TokenSource(ctx), nil
+}
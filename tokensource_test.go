@@ -0,0 +1,86 @@
+package gclientauth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// rotatingTokenSource returns a new token every other call.
+type rotatingTokenSource struct {
+	calls int
+}
+
+func (s *rotatingTokenSource) Token() (*oauth2.Token, error) {
+	s.calls++
+	return &oauth2.Token{AccessToken: fmt.Sprintf("at-%d", (s.calls+1)/2), Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+// countingStore is a MemoryTokenStore that counts the saves.
+type countingStore struct {
+	MemoryTokenStore
+	saves int
+}
+
+func (s *countingStore) Save(ctx context.Context, token *oauth2.Token) error {
+	s.saves++
+	return s.MemoryTokenStore.Save(ctx, token)
+}
+
+func TestPersistingTokenSource(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{}
+	saved := withScopes(&oauth2.Token{AccessToken: "at-1"}, []string{"email"})
+	src := newPersistingTokenSource(ctx, &rotatingTokenSource{}, store, saved, nopLogger{})
+
+	for i, want := range []string{"at-1", "at-1", "at-2", "at-2", "at-3"} {
+		token, err := src.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != want {
+			t.Errorf("Token() #%d = %q, want %q", i, token.AccessToken, want)
+		}
+	}
+	if store.saves != 2 {
+		t.Errorf("%d saves, want 2 (one per new token)", store.saves)
+	}
+	got, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != "at-3" {
+		t.Errorf("saved token = %q, want the last one", got.AccessToken)
+	}
+	if scopes := GrantedScopes(got); len(scopes) != 1 || scopes[0] != "email" {
+		t.Errorf("GrantedScopes(saved token) = %q, want the scopes of the previous token", scopes)
+	}
+}
+
+func TestGetTokenSourceSavesRefreshedToken(t *testing.T) {
+	ctx := context.Background()
+	srv := newTokenServer(t)
+	store := &MemoryTokenStore{}
+	expired := withScopes(&oauth2.Token{AccessToken: "expired", RefreshToken: "rt", Expiry: time.Now().Add(-time.Hour)}, []string{"email"})
+	if err := store.Save(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := GetTokenSource(ctx, credentialFile(t, installedCredential("client")), "", []string{"email"}, WithEndpoint(srv.endpoint()), WithTokenStore(store))
+	if err != nil {
+		t.Fatalf("GetTokenSource() error = %v", err)
+	}
+	token, err := src.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" || srv.requests("refresh_token") != 1 {
+		t.Fatalf("Token() = %q after %d refreshes, want the refreshed token", token.AccessToken, srv.requests("refresh_token"))
+	}
+	if saved, _ := store.Load(ctx); saved == nil || saved.AccessToken != "at" {
+		t.Errorf("saved token = %v, want the refreshed token", saved)
+	}
+}
@@ -0,0 +1,103 @@
+package gclientauth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// quotaProjectHeader is the header of the project Google APIs bill the quota
+// of a request to.
+const quotaProjectHeader = "X-Goog-User-Project"
+
+// headerTransport is an http.RoundTripper that adds headers to the requests of
+// base.
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+	// userAgent is appended to the User-Agent of the requests.
+	userAgent string
+}
+
+// RoundTrip sends a copy of the request with the headers added.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request.
+	req = req.Clone(req.Context())
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	if t.userAgent != "" {
+		if ua := req.Header.Get("User-Agent"); ua != "" {
+			req.Header.Set("User-Agent", ua+" "+t.userAgent)
+		} else {
+			req.Header.Set("User-Agent", t.userAgent)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newClient returns an HTTP client that authorizes its requests with the
+// tokens of src and adds the headers set with WithQuotaProject and
+// WithUserAgent.
+func (o *options) newClient(ctx context.Context, src oauth2.TokenSource) *http.Client {
+	// Unlike oauth2.NewClient, src isn't wrapped in an
+	// oauth2.ReuseTokenSource, which would keep the token until 10 seconds
+	// before it expires whatever WithExpiryDelta says.  src is asked for
+	// the token of every request instead.
+	c := &http.Client{Transport: &oauth2.Transport{Source: src, Base: contextClient(o.context(ctx)).Transport}}
+	header := make(http.Header)
+	if o.quotaProject != "" {
+		header.Set(quotaProjectHeader, o.quotaProject)
+	}
+	if len(header) > 0 || o.userAgent != "" {
+		c.Transport = &headerTransport{base: c.Transport, header: header, userAgent: o.userAgent}
+	}
+	return c
+}
+
+// maxResponseSize is how much of a response captureTransport keeps, the limit
+// of the oauth2 package for token responses.
+const maxResponseSize = 1 << 20
+
+// captureTransport is an http.RoundTripper that keeps the body of the last
+// response of base, or of http.DefaultTransport if base is nil.
+type captureTransport struct {
+	base http.RoundTripper
+	body []byte
+}
+
+// RoundTrip sends the request and reads the body of the response so it can
+// be read again by the caller.
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	t.body = body
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// AuthorizationHeader returns the value of the Authorization header of requests
+// authorized with the token, e.g. "Bearer <access token>", for callers that
+// make HTTP requests without the clients of this package.  The type of the
+// token is used for tokens that aren't bearer tokens.  It returns "" for a nil
+// token.
+func AuthorizationHeader(token *oauth2.Token) string {
+	if token == nil {
+		return ""
+	}
+	return token.Type() + " " + token.AccessToken
+}
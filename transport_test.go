@@ -0,0 +1,257 @@
+package gclientauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// recordingTransport is an http.RoundTripper that records the URLs of the
+// requests it sends with http.DefaultTransport.
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (t *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.urls = append(t.urls, r.URL.String())
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// saw returns whether a request for the URL was sent.
+func (t *recordingTransport) saw(url string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, u := range t.urls {
+		if u == url {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	srv := newTokenServer(t)
+	rec := &recordingTransport{}
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), installedCredential("client"), cachePath(t), []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")),
+		WithHTTPClient(&http.Client{Transport: rec}))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if !rec.saw(srv.endpoint().TokenURL) {
+		t.Errorf("the client sent %q, want the token exchange", rec.urls)
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	srv := newTokenServer(t)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+	rec := &recordingTransport{}
+
+	client, err := GetGoogleClient(context.Background(), credentialFile(t, installedCredential("client")), cachePath(t), []string{"email"},
+		WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n")), WithTransport(rec))
+	if err != nil {
+		t.Fatalf("GetGoogleClient() error = %v", err)
+	}
+	if !rec.saw(srv.endpoint().TokenURL) {
+		t.Errorf("the transport sent %q, want the token exchange", rec.urls)
+	}
+
+	resp, err := client.Get(api.URL + "/v1/thing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "Bearer at" {
+		t.Errorf("Authorization of the API request = %q, want the token", body)
+	}
+	if !rec.saw(api.URL + "/v1/thing") {
+		t.Errorf("the transport sent %q, want the API request", rec.urls)
+	}
+}
+
+// headerServer returns an API server that records the headers of the last
+// request.
+func headerServer(t *testing.T) (*httptest.Server, func() http.Header) {
+	var mu sync.Mutex
+	var last http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = r.Header.Clone()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+// apiRequest sends a request with the header to the API server with a client
+// of GetGoogleClient with the options and returns the headers it received.
+func apiRequest(t *testing.T, header http.Header, opts ...Option) http.Header {
+	srv := newTokenServer(t)
+	api, headers := headerServer(t)
+	opts = append([]Option{WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithCodeReader(strings.NewReader("c\n"))}, opts...)
+	client, err := GetGoogleClient(context.Background(), credentialFile(t, installedCredential("client")), cachePath(t), []string{"email"}, opts...)
+	if err != nil {
+		t.Fatalf("GetGoogleClient() error = %v", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, api.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(req.Header) != len(header) {
+		t.Errorf("the request headers were changed to %v", req.Header)
+	}
+	return headers()
+}
+
+func TestWithQuotaProject(t *testing.T) {
+	if got := apiRequest(t, nil, WithQuotaProject("my-project")).Get("X-Goog-User-Project"); got != "my-project" {
+		t.Errorf("X-Goog-User-Project = %q, want my-project", got)
+	}
+	if got := apiRequest(t, nil).Values("X-Goog-User-Project"); got != nil {
+		t.Errorf("X-Goog-User-Project = %q without WithQuotaProject, want none", got)
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		opts   []Option
+		want   string
+	}{
+		{name: "set", opts: []Option{WithUserAgent("my-tool/1.0")}, want: "my-tool/1.0"},
+		{name: "appended", header: http.Header{"User-Agent": {"google-api-go-client/0.5"}}, opts: []Option{WithUserAgent("my-tool/1.0")}, want: "google-api-go-client/0.5 my-tool/1.0"},
+		{name: "kept", header: http.Header{"User-Agent": {"google-api-go-client/0.5"}}, want: "google-api-go-client/0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := apiRequest(t, tt.header, tt.opts...)
+			if got := headers.Get("User-Agent"); got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+			if got := headers.Get("Authorization"); got != "Bearer at" {
+				t.Errorf("Authorization = %q, want the token", got)
+			}
+		})
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	tests := []struct {
+		token *oauth2.Token
+		want  string
+	}{
+		{token: &oauth2.Token{AccessToken: "at"}, want: "Bearer at"},
+		{token: &oauth2.Token{AccessToken: "at", TokenType: "bearer"}, want: "Bearer at"},
+		{token: &oauth2.Token{AccessToken: "at", TokenType: "MAC"}, want: "MAC at"},
+		{token: &oauth2.Token{AccessToken: "at", TokenType: "basic"}, want: "Basic at"},
+		{token: &oauth2.Token{AccessToken: "at", TokenType: "DPoP"}, want: "DPoP at"},
+		{token: nil, want: ""},
+	}
+	for _, tt := range tests {
+		got := AuthorizationHeader(tt.token)
+		if got != tt.want {
+			t.Errorf("AuthorizationHeader(%+v) = %q, want %q", tt.token, got, tt.want)
+		}
+		if tt.token == nil {
+			continue
+		}
+		// The header is the one the oauth2 package sends.
+		r := httptest.NewRequest("GET", "/", nil)
+		tt.token.SetAuthHeader(r)
+		if sent := r.Header.Get("Authorization"); got != sent {
+			t.Errorf("AuthorizationHeader(%+v) = %q, want %q as sent by the oauth2 package", tt.token, got, sent)
+		}
+	}
+}
+
+// The clients refresh the token once it is within the expiry delta, not just
+// 10 seconds before it expires as the oauth2 package's clients do.
+func TestClientRefreshesWithinExpiryDelta(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+	send := func(t *testing.T, c *http.Client) string {
+		resp, err := c.Get(api.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	clients := map[string]func(*testing.T, *tokenServer, TokenStore, Option) *http.Client{
+		"Result": func(t *testing.T, srv *tokenServer, store TokenStore, clock Option) *http.Client {
+			r, err := AuthenticateFromJSON(context.Background(), installedCredential("client"), "", []string{"email"},
+				WithTokenStore(store), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), clock)
+			if err != nil {
+				t.Fatalf("AuthenticateFromJSON() error = %v", err)
+			}
+			return r.Client(context.Background())
+		},
+		"Authenticator": func(t *testing.T, srv *tokenServer, store TokenStore, clock Option) *http.Client {
+			c, err := newTestAuthenticator(t, srv, store, clock).Client(context.Background())
+			if err != nil {
+				t.Fatalf("Client() error = %v", err)
+			}
+			return c
+		},
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			// The token is valid for an hour in real time, so only the
+			// expiry delta makes it due for a refresh.
+			expiry := time.Now().Add(time.Hour)
+			clock := &fakeClock{now: expiry.Add(-time.Hour)}
+			srv := newTokenServer(t)
+			// The refreshed token has to last beyond the clock too.
+			srv.response = strings.Replace(tokenResponse, `"expires_in":3600`, `"expires_in":7200`, 1)
+			store := &MemoryTokenStore{}
+			store.Save(context.Background(), withScopes(&oauth2.Token{AccessToken: "cached", RefreshToken: "rt", Expiry: expiry}, []string{"email"}))
+			c := client(t, srv, store, WithClock(clock.Now))
+			if got := send(t, c); got != "Bearer cached" {
+				t.Fatalf("Authorization = %q, want the cached token", got)
+			}
+			clock.advance(time.Hour - 20*time.Second)
+			for i := 0; i < 2; i++ {
+				if got := send(t, c); got != "Bearer at" {
+					t.Errorf("Authorization = %q 20 seconds before the expiry, want the refreshed token", got)
+				}
+			}
+			if n := srv.requests("refresh_token"); n != 1 {
+				t.Errorf("%d refreshes, want 1", n)
+			}
+		})
+	}
+}
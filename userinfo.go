@@ -0,0 +1,54 @@
+package gclientauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// googleUserInfoURL is Google's OpenID Connect userinfo endpoint.
+const googleUserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+
+// UserInfo is the profile of the user returned by the userinfo endpoint.
+// Which fields are set depends on the scopes granted (openid, email and
+// profile).
+type UserInfo struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	Locale        string `json:"locale"`
+	HostedDomain  string `json:"hd"`
+}
+
+// GetUserInfo returns the profile of the authenticated user using client, an
+// HTTP client authorized with the user's token such as the one returned by
+// GetGoogleClient.
+func GetUserInfo(ctx context.Context, client *http.Client) (*UserInfo, error) {
+	req, err := http.NewRequest("GET", googleUserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user info. %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read user info. %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get user info (status %v). %s", resp.Status, body)
+	}
+	var info UserInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("unable to decode user info. %w", err)
+	}
+	return &info, nil
+}
@@ -0,0 +1,41 @@
+package gclientauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestGetUserInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/userinfo" || r.Header.Get("Authorization") != "Bearer at" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"sub":"1","email":"user@example.com","email_verified":true,"name":"Test User","hd":"example.com"}`)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &oauth2.Transport{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "at"}),
+		Base:   rewriteTo(t, srv),
+	}}
+	info, err := GetUserInfo(context.Background(), client)
+	if err != nil {
+		t.Fatalf("GetUserInfo() error = %v", err)
+	}
+	want := UserInfo{Sub: "1", Email: "user@example.com", EmailVerified: true, Name: "Test User", HostedDomain: "example.com"}
+	if *info != want {
+		t.Errorf("GetUserInfo() = %+v, want %+v", *info, want)
+	}
+
+	unauthorized := &http.Client{Transport: rewriteTo(t, srv)}
+	if info, err := GetUserInfo(context.Background(), unauthorized); err == nil {
+		t.Errorf("GetUserInfo() without a token = %+v, want an error", info)
+	}
+}
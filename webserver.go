@@ -0,0 +1,208 @@
+package gclientauth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout is how long to wait for the response to the browser to be
+// sent before the web server is closed anyway.
+const shutdownTimeout = 5 * time.Second
+
+// The default timeouts of the web server so misbehaving clients can't keep
+// connections open, see WithServerTimeouts.  The browser only sends a small
+// GET request.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+)
+
+// callbackResult is what the web server received on the redirect back from
+// the authorization server, or what the user entered for desktop/other
+// credentials.
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// webServer is the local web server that waits for the redirect back from the
+// authorization server in the three-legged auth flow.
+type webServer struct {
+	listener net.Listener
+	server   *http.Server
+	// results receives the first callbackResult.  It is buffered so the
+	// handler doesn't block if nobody is waiting anymore.
+	results chan callbackResult
+}
+
+// authResponseError returns the error for the error code and description of an
+// authorization response.
+func authResponseError(code, description string) error {
+	if code == "access_denied" {
+		return ErrAuthDenied
+	}
+	if description != "" {
+		return fmt.Errorf("authorization failed: %v (%v)", code, description)
+	}
+	return fmt.Errorf("authorization failed: %v", code)
+}
+
+// startWebServer starts a web server that waits for an oauth code in the
+// three-legged auth flow.  The caller can find the address it is bound to from
+// its listener and must stop it with shutdown or close.  It listens on port of
+// hostname; an empty port or "0" binds to a free port picked by the operating
+// system.  The listener set with WithListener is used instead if there is one.
+// With WithTLS, HTTPS is served with a self-signed certificate.
+//
+// Only requests for path are handled, others get a 404.  A response whose
+// state doesn't match state is reported as ErrStateMismatch.  An error response
+// from the authorization server is reported as the error.  Requests without a
+// code or an error are ignored.
+func startWebServer(hostname, port, path, state string, o *options) (*webServer, error) {
+	listener, err := o.listen(hostname, port)
+	if err != nil {
+		return nil, err
+	}
+	if o.tls {
+		cert, err := selfSignedCert(hostname)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+	s := &webServer{
+		listener: listener,
+		results:  make(chan callbackResult, 1),
+	}
+	s.server = &http.Server{
+		Handler:           http.HandlerFunc(s.handler(path, state, o)),
+		ReadHeaderTimeout: o.readHeaderTimeout,
+		ReadTimeout:       o.readTimeout,
+		IdleTimeout:       o.idleTimeout,
+	}
+
+	go func() {
+		// Serve only returns early if the listener fails, e.g. because
+		// the listener set with WithListener was closed, so the flow
+		// doesn't wait for a redirect that can't arrive.
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.send(callbackResult{err: fmt.Errorf("unable to accept connections on %v. %w", listener.Addr(), err)})
+		}
+	}()
+	return s, nil
+}
+
+// listen returns the listener set with WithListener or a new listener on port
+// of hostname.
+func (o *options) listen(hostname, port string) (net.Listener, error) {
+	if o.listener != nil {
+		if _, ok := o.listener.Addr().(*net.TCPAddr); !ok {
+			return nil, fmt.Errorf("unable to use the listener on %v %v, it is not a TCP listener", o.listener.Addr().Network(), o.listener.Addr())
+		}
+		if err := checkOpen(o.listener); err != nil {
+			return nil, fmt.Errorf("unable to use the listener on %v, it is closed, e.g. by an earlier flow. %w", o.listener.Addr(), err)
+		}
+		return o.listener, nil
+	}
+	if port == "" {
+		port = "0"
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(hostname, port))
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %v. %w", hostname, err)
+	}
+	return listener, nil
+}
+
+// checkOpen returns an error if the listener has been closed.  Listeners that
+// don't give access to their socket are assumed to be open.
+func checkOpen(listener net.Listener) error {
+	sc, ok := listener.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return rc.Control(func(fd uintptr) {})
+}
+
+// canListen returns whether a listener can be bound to port of hostname.
+func canListen(hostname, port string) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort(hostname, port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// handler returns the handler for the redirect back from the authorization
+// server to path.
+func (s *webServer) handler(path, state string, o *options) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		code, authErr := r.FormValue("code"), r.FormValue("error")
+		if code == "" && authErr == "" {
+			// Not the redirect from the authorization server, e.g. the
+			// browser asking for /favicon.ico.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.FormValue("state") != state {
+			s.send(callbackResult{err: ErrStateMismatch})
+			http.Error(w, "The authorization response is not for this request.", http.StatusBadRequest)
+			return
+		}
+		if authErr != "" {
+			s.send(callbackResult{err: authResponseError(authErr, r.FormValue("error_description"))})
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "Authorization failed: %v\r\nYou can now safely close this browser window.", authErr)
+			return
+		}
+		s.send(callbackResult{code: code})
+		switch {
+		case o.successRedirect != "":
+			http.Redirect(w, r, o.successRedirect, http.StatusFound)
+		case o.successPage != "":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, o.successPage)
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, "Received code: %v\r\nYou can now safely close this browser window.", code)
+		}
+	}
+}
+
+// send sends the result to the OAuth flow unless a result was already sent.
+func (s *webServer) send(result callbackResult) {
+	select {
+	case s.results <- result:
+	default:
+	}
+}
+
+// shutdown stops the web server after the responses being sent have been
+// completely written.
+func (s *webServer) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// close stops the web server immediately.
+func (s *webServer) close() {
+	s.server.Close()
+}
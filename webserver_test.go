@@ -0,0 +1,532 @@
+package gclientauth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// testWebServer starts a web server on a free port of the loopback that waits
+// for the redirect to /cb with the state "s".  It returns the URL of /cb.
+func testWebServer(t *testing.T, opts ...Option) (*webServer, string) {
+	s, err := startWebServer("127.0.0.1", "0", "/cb", "s", newOptions(opts...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.close)
+	return s, "http://" + s.listener.Addr().String() + "/cb"
+}
+
+// noRedirectClient is an HTTP client that returns redirects instead of
+// following them.
+var noRedirectClient = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+// get requests the URL and returns the response with its body read.
+func get(t *testing.T, url string) (*http.Response, string) {
+	resp, err := noRedirectClient.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestWebServerSuccessPage(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantStatus   int
+		wantType     string
+		wantBody     string
+		wantLocation string
+	}{
+		{name: "default", wantStatus: http.StatusOK, wantType: "text/plain", wantBody: "Received code: c\r\nYou can now safely close this browser window."},
+		{name: "WithSuccessPage", opts: []Option{WithSuccessPage("<h1>Done</h1>")}, wantStatus: http.StatusOK, wantType: "text/html; charset=utf-8", wantBody: "<h1>Done</h1>"},
+		{name: "WithSuccessRedirect", opts: []Option{WithSuccessRedirect("https://example.com/done")}, wantStatus: http.StatusFound, wantLocation: "https://example.com/done"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, cb := testWebServer(t, tt.opts...)
+			resp, body := get(t, cb+"?state=s&code=c")
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantType != "" && resp.Header.Get("Content-Type") != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", resp.Header.Get("Content-Type"), tt.wantType)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if l := resp.Header.Get("Location"); l != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", l, tt.wantLocation)
+			}
+			if r := <-s.results; r.code != "c" || r.err != nil {
+				t.Errorf("result = %+v, want the code", r)
+			}
+		})
+	}
+}
+
+func TestWebServerIgnoresOtherRequests(t *testing.T) {
+	s, cb := testWebServer(t)
+	base := cb[:len(cb)-len("/cb")]
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{url: base + "/favicon.ico", want: http.StatusNotFound},
+		{url: cb, want: http.StatusNoContent},
+		{url: cb + "?state=s&code=", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if resp, _ := get(t, tt.url); resp.StatusCode != tt.want {
+			t.Errorf("GET %v status = %v, want %v", tt.url, resp.StatusCode, tt.want)
+		}
+	}
+	select {
+	case r := <-s.results:
+		t.Fatalf("result = %+v, want none", r)
+	default:
+	}
+
+	get(t, cb+"?state=s&code=c")
+	if r := <-s.results; r.code != "c" {
+		t.Errorf("result = %+v, want the code of the redirect", r)
+	}
+}
+
+func TestWebServerErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantDenied bool
+		wantErr    string
+	}{
+		{name: "access_denied", query: "state=s&error=access_denied", wantDenied: true},
+		{name: "other error", query: "state=s&error=invalid_scope&error_description=bad+scope", wantErr: "authorization failed: invalid_scope (bad scope)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, cb := testWebServer(t)
+			_, body := get(t, cb+"?"+tt.query)
+			if !strings.HasPrefix(body, "Authorization failed") {
+				t.Errorf("body = %q, want a failure message", body)
+			}
+			r := <-s.results
+			if got := errors.Is(r.err, ErrAuthDenied); got != tt.wantDenied {
+				t.Errorf("error = %v, is ErrAuthDenied = %v, want %v", r.err, got, tt.wantDenied)
+			}
+			if tt.wantErr != "" && (r.err == nil || r.err.Error() != tt.wantErr) {
+				t.Errorf("error = %v, want %q", r.err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebFlowAuthDenied(t *testing.T) {
+	srv := newTokenServer(t)
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithBrowserOpener(redirectingBrowser(t, "error=access_denied", nil)))
+	if !errors.Is(err, ErrAuthDenied) {
+		t.Errorf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrAuthDenied)
+	}
+	if n := srv.requests("authorization_code"); n != 0 {
+		t.Errorf("%d exchanges, want none", n)
+	}
+}
+
+func TestWebFlowAuthTimeout(t *testing.T) {
+	addrs := make(chan string, 1)
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithPromptWriter(io.Discard), WithAuthTimeout(50*time.Millisecond),
+		WithBrowserOpener(func(string) error { return nil }),
+		WithListenerCallback(func(addr string) { addrs <- addr }))
+	if !errors.Is(err, ErrAuthTimeout) {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v, want %v", err, ErrAuthTimeout)
+	}
+	if c, err := net.Dial("tcp", <-addrs); err == nil {
+		c.Close()
+		t.Error("the web server still accepts connections after the timeout")
+	}
+}
+
+func TestWebFlowTLS(t *testing.T) {
+	srv := newTokenServer(t)
+	redirects := make(chan string, 1)
+	token, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithTLS(true), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithBrowserOpener(redirectingBrowser(t, "code=c", redirects)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want %q", token.AccessToken, "at")
+	}
+	if r := <-redirects; !strings.HasPrefix(r, "https://localhost:") {
+		t.Errorf("redirect URI = %q, want an https loopback URI", r)
+	}
+}
+
+func TestWebServerTLSCertificate(t *testing.T) {
+	s, err := startWebServer("127.0.0.1", "0", "/cb", "s", newOptions(WithTLS(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	conn, err := tls.Dial("tcp", s.listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("TLS handshake failed: %v", err)
+	}
+	defer conn.Close()
+	cert := conn.ConnectionState().PeerCertificates[0]
+	if err := cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("the certificate isn't for the loopback: %v", err)
+	}
+	if !cert.NotAfter.After(time.Now()) {
+		t.Errorf("the certificate expired at %v", cert.NotAfter)
+	}
+}
+
+func TestRedirectPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		redirect string
+		opts     []Option
+		want     string
+	}{
+		{name: "credential path", redirect: "http://localhost/oauth2/callback", want: "/oauth2/callback"},
+		{name: "no path", redirect: "http://localhost", want: ""},
+		{name: "WithRedirectPath", redirect: "http://localhost/oauth2/callback", opts: []Option{WithRedirectPath("/other")}, want: "/other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTokenServer(t)
+			redirects := make(chan string, 1)
+			browser := redirectingBrowser(t, "code=c", redirects)
+			var wrongPath int
+			open := func(authURL string) error {
+				u, err := url.Parse(authURL)
+				if err != nil {
+					return err
+				}
+				redirect, err := url.Parse(u.Query().Get("redirect_uri"))
+				if err != nil {
+					return err
+				}
+				// The code isn't accepted on other paths.
+				resp, err := http.Get("http://" + redirect.Host + "/wrong?state=" + url.QueryEscape(u.Query().Get("state")) + "&code=wrong")
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+				wrongPath = resp.StatusCode
+				return browser(authURL)
+			}
+			opts := append([]Option{WithPort("0"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithBrowserOpener(open)}, tt.opts...)
+			if _, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential(tt.redirect), cachePath(t), []string{"email"}, opts...); err != nil {
+				t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+			}
+			u, err := url.Parse(<-redirects)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Path != tt.want {
+				t.Errorf("redirect URI path = %q, want %q", u.Path, tt.want)
+			}
+			if wrongPath != http.StatusNotFound {
+				t.Errorf("status of another path = %v, want %v", wrongPath, http.StatusNotFound)
+			}
+			if code := srv.lastForm().Get("code"); code != "c" {
+				t.Errorf("exchanged code = %q, want the code of the redirect path", code)
+			}
+		})
+	}
+}
+
+func TestListenerCallback(t *testing.T) {
+	srv := newTokenServer(t)
+	redirects := make(chan string, 1)
+	var addrs []string
+	callback := func(addr string) {
+		addrs = append(addrs, addr)
+		// The server is up when the callback is called.
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Errorf("unable to connect to %v: %v", addr, err)
+			return
+		}
+		c.Close()
+	}
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithListenerCallback(callback),
+		WithBrowserOpener(redirectingBrowser(t, "code=c", redirects)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if len(addrs) != 1 {
+		t.Fatalf("callback called with %q, want once", addrs)
+	}
+	host, port, err := net.SplitHostPort(addrs[0])
+	if err != nil || net.ParseIP(host) == nil || port == "0" {
+		t.Fatalf("callback address = %q, want an IP address and the port picked by the operating system", addrs[0])
+	}
+	u, err := url.Parse(<-redirects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Port() != port {
+		t.Errorf("redirect URI %v doesn't have the port %v of the callback", u, port)
+	}
+}
+
+func TestWebServerTimeouts(t *testing.T) {
+	o := newOptions()
+	if o.readHeaderTimeout != 10*time.Second || o.readTimeout != 30*time.Second || o.idleTimeout != 60*time.Second {
+		t.Errorf("default timeouts = %v, %v, %v, want 10s, 30s, 60s", o.readHeaderTimeout, o.readTimeout, o.idleTimeout)
+	}
+	o = newOptions(WithServerTimeouts(time.Second, 0, -1))
+	if o.readHeaderTimeout != time.Second || o.readTimeout != 30*time.Second || o.idleTimeout != 60*time.Second {
+		t.Errorf("timeouts = %v, %v, %v, want 1s and the defaults", o.readHeaderTimeout, o.readTimeout, o.idleTimeout)
+	}
+}
+
+func TestWebServerSlowClient(t *testing.T) {
+	s, _ := testWebServer(t, WithServerTimeouts(50*time.Millisecond, 50*time.Millisecond, 50*time.Millisecond))
+	c, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// The request headers are never finished.
+	if _, err := io.WriteString(c, "GET /cb?state=s&code=c HTTP/1.1\r\nHost: localhost\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	io.Copy(io.Discard, c)
+	if d := time.Since(start); d >= 5*time.Second {
+		t.Fatalf("the connection of a slow client is still open after %v", d)
+	}
+	select {
+	case r := <-s.results:
+		t.Errorf("result = %+v, want none from an unfinished request", r)
+	default:
+	}
+}
+
+func TestWebFlowBindAddress(t *testing.T) {
+	srv := newTokenServer(t)
+	var addr string
+	logger := &recordingLogger{}
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithPort("0"), WithBindAddress("127.0.0.1"), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithLogger(logger),
+		WithListenerCallback(func(a string) { addr = a }), WithBrowserOpener(redirectingBrowser(t, "code=c", nil)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if host, _, err := net.SplitHostPort(addr); err != nil || host != "127.0.0.1" {
+		t.Errorf("listened on %q, want the bind address", addr)
+	}
+	if logger.contains("(WARNING)") {
+		t.Errorf("logged %q, want no warning for a loopback address", logger.lines)
+	}
+}
+
+// fakeSignals replaces the signal notification of the options with a channel
+// the test sends the signals on.
+type fakeSignals struct {
+	mu       sync.Mutex
+	notified chan<- os.Signal
+	signals  []os.Signal
+	stopped  bool
+}
+
+func (f *fakeSignals) install(o *options) {
+	o.notify = func(c chan<- os.Signal, sig ...os.Signal) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.notified, f.signals = c, sig
+	}
+	o.stopNotify = func(c chan<- os.Signal) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.stopped = c == f.notified
+	}
+}
+
+func (f *fakeSignals) send(sig os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notified <- sig
+}
+
+func TestWebFlowInterrupted(t *testing.T) {
+	signals := &fakeSignals{}
+	addrs := make(chan string, 1)
+	o := newOptions(WithSignalHandling(true), WithPort("0"), WithPromptWriter(io.Discard),
+		WithBrowserOpener(func(string) error { return nil }),
+		WithListenerCallback(func(addr string) {
+			addrs <- addr
+			signals.send(os.Interrupt)
+		}))
+	signals.install(o)
+	req, err := newAuthRequest(o, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = getCodeFromWeb(context.Background(), &oauth2.Config{RedirectURL: "http://localhost/cb"}, req, o)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("getCodeFromWeb() error = %v, want %v", err, ErrInterrupted)
+	}
+	if !reflect.DeepEqual(signals.signals, []os.Signal{os.Interrupt, syscall.SIGTERM}) {
+		t.Errorf("handled signals = %v, want SIGINT and SIGTERM", signals.signals)
+	}
+	if !signals.stopped {
+		t.Error("the signals are still handled after the flow")
+	}
+	if c, err := net.Dial("tcp", <-addrs); err == nil {
+		c.Close()
+		t.Error("the web server still accepts connections after the interrupt")
+	}
+}
+
+func TestWebFlowSignalHandling(t *testing.T) {
+	for _, handle := range []bool{false, true} {
+		signals := &fakeSignals{}
+		o := newOptions(WithSignalHandling(handle), WithPort("0"), WithPromptWriter(io.Discard),
+			WithBrowserOpener(redirectingBrowser(t, "code=c", nil)))
+		signals.install(o)
+		req, err := newAuthRequest(o, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code, err := getCodeFromWeb(context.Background(), &oauth2.Config{RedirectURL: "http://localhost/cb"}, req, o); err != nil || code != "c" {
+			t.Fatalf("getCodeFromWeb() = %q, %v, want the code", code, err)
+		}
+		if handled := signals.notified != nil; handled != handle {
+			t.Errorf("WithSignalHandling(%v) handled signals = %v", handle, handled)
+		}
+		if handle && !signals.stopped {
+			t.Error("the signals are still handled after the flow")
+		}
+	}
+}
+
+func TestWithListener(t *testing.T) {
+	srv := newTokenServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	redirects := make(chan string, 1)
+	var addr string
+	_, _, err = GetGoogleOauth2TokenFromJSON(context.Background(), webCredential("http://localhost:8080/cb"), cachePath(t), []string{"email"},
+		WithListener(listener), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard),
+		WithListenerCallback(func(a string) { addr = a }), WithBrowserOpener(redirectingBrowser(t, "code=c", redirects)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if addr != listener.Addr().String() {
+		t.Errorf("listened on %q, want the listener's %v", addr, listener.Addr())
+	}
+	u, err := url.Parse(<-redirects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port); u.Port() != want {
+		t.Errorf("redirect URI %v, want the port %v of the listener", u, want)
+	}
+
+	// The listener is closed with the web server so it can't be used again.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err = GetGoogleOauth2TokenFromJSON(ctx, webCredential("http://localhost/cb"), cachePath(t), []string{"email"},
+		WithListener(listener), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithManualFallback(false),
+		WithBrowserOpener(func(string) error { return nil }))
+	if err == nil || !strings.Contains(err.Error(), "it is closed") {
+		t.Errorf("GetGoogleOauth2TokenFromJSON() with a closed listener error = %v, want it rejected", err)
+	}
+}
+
+func TestWithListenerNotTCP(t *testing.T) {
+	dir := t.TempDir()
+	listener, err := net.Listen("unix", dir+"/socket")
+	if err != nil {
+		t.Skipf("unix sockets aren't supported: %v", err)
+	}
+	defer listener.Close()
+	if _, err := newOptions(WithListener(listener)).listen("", ""); err == nil || !strings.Contains(err.Error(), "not a TCP listener") {
+		t.Errorf("listen() error = %v, want the listener rejected", err)
+	}
+}
+
+// failingListener is a listener whose Accept fails.
+type failingListener struct {
+	net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failed")
+}
+
+// The flow doesn't wait for a redirect the server can't accept.
+func TestWebServerAcceptFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	o := newOptions(WithListener(failingListener{listener}), WithPromptWriter(io.Discard), WithBrowserOpener(func(string) error { return nil }))
+	req, err := newAuthRequest(o, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = getCodeFromWeb(ctx, &oauth2.Config{RedirectURL: "http://localhost/cb"}, req, o)
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "accept failed") {
+		t.Errorf("getCodeFromWeb() error = %v, want the error of the listener", err)
+	}
+}
+
+// The web server listens on the redirect URL's port the browser is sent to,
+// not on a contradicting WithPort.
+func TestWebFlowRedirectPortWins(t *testing.T) {
+	srv := newTokenServer(t)
+	redirect := "http://localhost:" + freePort(t) + "/cb"
+	var addr string
+	logger := &recordingLogger{}
+	_, _, err := GetGoogleOauth2TokenFromJSON(context.Background(), webCredential(redirect), cachePath(t), []string{"email"},
+		WithPort(freePort(t)), WithEndpoint(srv.endpoint()), WithPromptWriter(io.Discard), WithLogger(logger), WithAuthTimeout(5*time.Second),
+		WithListenerCallback(func(a string) { addr = a }), WithBrowserOpener(redirectingBrowser(t, "code=c", nil)))
+	if err != nil {
+		t.Fatalf("GetGoogleOauth2TokenFromJSON() error = %v", err)
+	}
+	if _, port, _ := net.SplitHostPort(addr); "http://localhost:"+port+"/cb" != redirect {
+		t.Errorf("listened on %q, want the port of %v", addr, redirect)
+	}
+	if !logger.contains("(WARNING) The web server listens on the redirect URL's port") {
+		t.Errorf("logged %q, want a warning about the ignored port", logger.lines)
+	}
+}